@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/service"
+	"bromato-sales/internal/sales/stats"
+)
+
+const usage = `usage:
+  bromato                                         run the tracker
+  bromato dead-letter list [channel]              list dead-lettered sales
+  bromato dead-letter requeue <saleId> <channel>  requeue a dead-lettered sale
+  bromato leaderboard [collection] [window]       list the top sales, of the past 7d by default`
+
+// runCommand runs an operational command given on the command line instead of
+// running the tracker
+func runCommand(svc *service.Service, r *reader.Service, args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "leaderboard" {
+		return listLeaderboard(r, args[1:], out)
+	}
+
+	if len(args) < 2 || args[0] != "dead-letter" {
+		return errors.New(usage)
+	}
+
+	switch args[1] {
+	case "list":
+		var channel sales.PublishChannel
+		if len(args) > 2 {
+			channel = sales.PublishChannel(args[2])
+		}
+		return listDeadLettered(svc, channel, out)
+	case "requeue":
+		if len(args) != 4 {
+			return errors.New(usage)
+		}
+		if err := svc.Requeue(args[2], sales.PublishChannel(args[3])); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "requeued %s on %s\n", args[2], args[3])
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+func listDeadLettered(svc *service.Service, channel sales.PublishChannel, out io.Writer) error {
+	records, err := svc.ListDeadLettered(channel)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SALE\tCHANNEL\tATTEMPTS\tDEAD LETTERED AT\tLAST ERROR")
+	for i := range records {
+		channels := make([]string, 0, len(records[i].Publishes))
+		for c := range records[i].Publishes {
+			channels = append(channels, string(c))
+		}
+		sort.Strings(channels)
+
+		for _, c := range channels {
+			state := records[i].Publishes[sales.PublishChannel(c)]
+			if state == nil || state.Status != sales.PublishDead || (channel != "" && sales.PublishChannel(c) != channel) {
+				continue
+			}
+
+			var deadLetteredAt string
+			if state.DeadLetteredAt != nil {
+				deadLetteredAt = state.DeadLetteredAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", records[i].ID, c, state.Attempts, deadLetteredAt, state.LastError)
+		}
+	}
+
+	return w.Flush()
+}
+
+// listLeaderboard lists the top sales of the window, args are the optional
+// collection and window
+func listLeaderboard(r *reader.Service, args []string, out io.Writer) error {
+	if len(args) > 2 {
+		return errors.New(usage)
+	}
+
+	var filter reader.Filter
+	if len(args) > 0 {
+		filter.Collection = sales.NFTCollection(args[0])
+	}
+
+	window := stats.Week
+	if len(args) > 1 {
+		var err error
+		if window, err = stats.ParseWindow(args[1]); err != nil {
+			return err
+		}
+	}
+	filter.From = window.Since(time.Now())
+	filter.Limit = 10
+
+	records, err := r.TopSales(filter)
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tPRICE (SOL)\tNFT\tCOLLECTION\tMARKETPLACE\tSALE TIME\tSALE")
+	for i := range records {
+		var saleTime string
+		if records[i].SaleTime != nil {
+			saleTime = records[i].SaleTime.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1,
+			sales.FormatSOL(records[i].Price),
+			records[i].NFT.Name,
+			records[i].Collection,
+			records[i].Marketplace,
+			saleTime,
+			records[i].ID,
+		)
+	}
+
+	return w.Flush()
+}
@@ -53,11 +53,33 @@ if ! couchbase-cli server-list -c localhost:8091 -u Administrator -p password >/
     --bucket 'local' \
     --create-collection 'nfts.sales'
 
+  couchbase-cli collection-manage \
+    --cluster localhost:8091 \
+    --username Administrator \
+    --password password \
+    --bucket 'local' \
+    --create-collection 'nfts.locks'
+
+  couchbase-cli collection-manage \
+    --cluster localhost:8091 \
+    --username Administrator \
+    --password password \
+    --bucket 'local' \
+    --create-collection 'nfts.recaps'
+
+  couchbase-cli collection-manage \
+    --cluster localhost:8091 \
+    --username Administrator \
+    --password password \
+    --bucket 'local' \
+    --create-collection 'nfts.milestones'
+
   echo "pausing for services to come up..."
   sleep 15
 
   cbq -u Administrator -p password -s="CREATE PRIMARY INDEX ON \`local\`.nfts.sales;"
   cbq -u Administrator -p password -s="CREATE INDEX adv_publishDetails_saleTime ON \`default\`:\`local\`.\`nfts\`.\`sales\`(\`publishDetails\`,\`saleTime\`);"
+  cbq -u Administrator -p password -s="CREATE INDEX adv_saleTime_publishes ON \`default\`:\`local\`.\`nfts\`.\`sales\`(\`saleTime\`,\`publishes\`);"
 fi
 
 fg 1
@@ -6,13 +6,18 @@ require (
 	github.com/caarlos0/env/v6 v6.7.2
 	github.com/couchbase/gocb/v2 v2.3.4
 	github.com/dghubble/go-twitter v0.0.0-20211115160449-93a8679adecb // indirect
-	github.com/dghubble/oauth1 v0.7.0 // indirect
+	github.com/dghubble/oauth1 v0.7.0
 	github.com/gagliardetto/binary v0.5.0
 	github.com/gagliardetto/metaplex-go v0.1.3
 	github.com/gagliardetto/solana-go v1.0.2
+	github.com/gorilla/websocket v1.4.2
+	github.com/graph-gophers/graphql-go v1.3.0
+	github.com/prometheus/client_golang v1.10.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/atomic v1.9.0 // indirect
-	go.uber.org/multierr v1.7.0 // indirect
+	go.uber.org/multierr v1.7.0
 	go.uber.org/zap v1.19.1
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 )
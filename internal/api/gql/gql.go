@@ -0,0 +1,190 @@
+package gql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+const (
+	// maxDepth and maxParallelism bound the cost of a single query
+	maxDepth       = 10
+	maxParallelism = 10
+
+	maxBodyBytes = 1 << 20
+)
+
+// Handler serves the GraphQL API over the stored sales and their stats
+type Handler struct {
+	logger *zap.Logger
+	reader *reader.Service
+	schema *graphql.Schema
+	stats  *stats.Service
+}
+
+// request is a GraphQL request, given as the JSON body of a POST or as the
+// parameters of a GET
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func NewHandler(logger *zap.Logger, r *reader.Service, st *stats.Service) (*Handler, error) {
+	h := Handler{
+		logger: logger,
+		reader: r,
+		stats:  st,
+	}
+
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+
+	s, err := graphql.ParseSchema(
+		schema,
+		&resolver{logger: h.logger, reader: h.reader, stats: h.stats},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(maxDepth),
+		graphql.MaxParallelism(maxParallelism),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse graphql schema: %w", err)
+	}
+	h.schema = s
+
+	return &h, nil
+}
+
+func (h *Handler) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return h.logger != nil },
+		},
+		{
+			dep: "reader",
+			chk: func() bool { return h.reader != nil },
+		},
+		{
+			dep: "stats",
+			chk: func() bool { return h.stats != nil },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize graphql handler due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// ServeHTTP executes the query of a GET or POST request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeErrors(w, http.StatusBadRequest, "invalid variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeErrors(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if req.Query == "" {
+		writeErrors(w, http.StatusBadRequest, "missing query")
+		return
+	}
+
+	ctx := withLoaders(r.Context(), &loaders{stats: newStatsLoader(h.logger, h.stats)})
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// errorsResponse is the body of a request that couldn't be executed, in the
+// shape of GraphQL errors
+type errorsResponse struct {
+	Errors []errorResponse `json:"errors"`
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func writeErrors(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorsResponse{Errors: []errorResponse{{Message: msg}}})
+}
+
+// encodeCursor encodes the position of a sale as an opaque string, it holds
+// the price so that it serves every order
+func encodeCursor(c *reader.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatUint(c.Price, 10) + "|" + c.SaleTime.UTC().Format(time.RFC3339Nano) + "|" + c.ID,
+	))
+}
+
+func decodeCursor(s string) (*reader.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(b), "|", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, errors.New("malformed cursor")
+	}
+
+	price, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader.Cursor{SaleTime: t, ID: parts[2], Price: price}, nil
+}
@@ -0,0 +1,124 @@
+package gql
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+type loadersKey struct{}
+
+// loaders load the data shared by the fields of a request once, whichever
+// fields resolve it
+type loaders struct {
+	stats *statsLoader
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// statsLoader loads the stats of every collection of a window once, the
+// stats of a collection, or of a marketplace, are then taken from them
+type statsLoader struct {
+	logger *zap.Logger
+	stats  *stats.Service
+
+	mu    sync.Mutex
+	calls map[statsKey]*statsCall
+}
+
+type statsKey struct {
+	window     stats.Window
+	collection sales.NFTCollection
+}
+
+type statsCall struct {
+	once   sync.Once
+	result []stats.Stats
+	err    error
+}
+
+func newStatsLoader(logger *zap.Logger, st *stats.Service) *statsLoader {
+	return &statsLoader{logger: logger, stats: st, calls: make(map[statsKey]*statsCall)}
+}
+
+// load returns the stats of the window for the collection, every collection
+// when empty
+func (l *statsLoader) load(window stats.Window, collection sales.NFTCollection) ([]stats.Stats, error) {
+	key := statsKey{window: window, collection: collection}
+
+	l.mu.Lock()
+	c, ok := l.calls[key]
+	if !ok {
+		c = &statsCall{}
+		l.calls[key] = c
+	}
+	l.mu.Unlock()
+
+	c.once.Do(func() {
+		c.result, c.err = l.stats.Get(window, stats.Filter{Collection: collection})
+		if c.err != nil {
+			l.logger.Error("unable to get stats", zap.Error(c.err), zap.String("window", string(window)))
+			c.err = errInternal
+		}
+	})
+
+	return c.result, c.err
+}
+
+// mintBatch loads the last sales of the NFTs of a set of sales e.g. a page of
+// sales, in a single query once the first of them is resolved
+type mintBatch struct {
+	logger *zap.Logger
+	reader *reader.Service
+	mints  []string
+
+	once   sync.Once
+	latest map[string]sales.Record
+	err    error
+}
+
+func newMintBatch(logger *zap.Logger, r *reader.Service, records []sales.Record) *mintBatch {
+	b := mintBatch{logger: logger, reader: r}
+
+	seen := make(map[string]bool, len(records))
+	for i := range records {
+		if mint := records[i].MintPubkey; !seen[mint] {
+			seen[mint] = true
+			b.mints = append(b.mints, mint)
+		}
+	}
+
+	return &b
+}
+
+// load returns the last sale of the mint, nil when it has never sold
+func (b *mintBatch) load(mint string) (*sales.Record, error) {
+	b.once.Do(func() {
+		b.latest, b.err = b.reader.LatestByMint(b.mints)
+		if b.err != nil {
+			b.logger.Error("unable to get last sales", zap.Error(b.err))
+			b.err = errInternal
+		}
+	})
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	rec, ok := b.latest[mint]
+	if !ok {
+		return nil, nil
+	}
+
+	return &rec, nil
+}
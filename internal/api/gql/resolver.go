@@ -0,0 +1,221 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+// errInternal is returned in place of the errors of the store, which aren't
+// exposed to clients
+var errInternal = errors.New("internal error")
+
+// resolver resolves the queries
+type resolver struct {
+	logger *zap.Logger
+	reader *reader.Service
+	stats  *stats.Service
+}
+
+type saleFilter struct {
+	Collection  *string
+	Marketplace *string
+	Mint        *string
+	Buyer       *string
+	Seller      *string
+	MinPrice    *lamports
+	MaxPrice    *lamports
+	From        *graphql.Time
+	To          *graphql.Time
+}
+
+// orders map the SaleOrder enum values to the search orders
+var orders = map[string]reader.Order{
+	"RECENT": reader.OrderRecent,
+	"PRICE":  reader.OrderPrice,
+}
+
+func (r *resolver) Sale(args struct{ Signature string }) (*saleResolver, error) {
+	rec, err := r.reader.Get(args.Signature)
+	switch {
+	case err == nil:
+	case errors.Is(err, sales.ErrNotFound):
+		return nil, nil
+	default:
+		r.logger.Error("unable to get sale", zap.Error(err), zap.String("saleId", args.Signature))
+		return nil, errInternal
+	}
+
+	return &saleResolver{rec: *rec, batch: newMintBatch(r.logger, r.reader, []sales.Record{*rec})}, nil
+}
+
+func (r *resolver) Sales(args struct {
+	Filter  *saleFilter
+	OrderBy string
+	First   int32
+	After   *string
+}) (*saleConnectionResolver, error) {
+	if args.First < 1 || args.First > reader.MaxSearchLimit {
+		return nil, fmt.Errorf("first must be between 1 and %d", reader.MaxSearchLimit)
+	}
+
+	filter := reader.Filter{Limit: int(args.First)}
+	if f := args.Filter; f != nil {
+		filter.Collection = sales.NFTCollection(value(f.Collection))
+		filter.Marketplace = value(f.Marketplace)
+		filter.Mint = value(f.Mint)
+		filter.Buyer = value(f.Buyer)
+		filter.Seller = value(f.Seller)
+		if f.MinPrice != nil {
+			p := uint64(*f.MinPrice)
+			filter.MinPrice = &p
+		}
+		if f.MaxPrice != nil {
+			p := uint64(*f.MaxPrice)
+			filter.MaxPrice = &p
+		}
+		if f.From != nil {
+			filter.From = &f.From.Time
+		}
+		if f.To != nil {
+			filter.To = &f.To.Time
+		}
+	}
+
+	order, ok := orders[args.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown order %q", args.OrderBy)
+	}
+	filter.Order = order
+
+	if args.After != nil {
+		after, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		filter.After = after
+	}
+
+	records, err := r.reader.Search(filter)
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		r.logger.Error("unable to search sales", zap.Error(err))
+		return nil, errInternal
+	}
+
+	// the NFTs of the page load their last sales together
+	batch := newMintBatch(r.logger, r.reader, records)
+	conn := saleConnectionResolver{edges: make([]*saleEdgeResolver, 0, len(records))}
+	for i := range records {
+		conn.edges = append(conn.edges, &saleEdgeResolver{
+			cursor: encodeCursor(reader.CursorOf(records[i])),
+			node:   &saleResolver{rec: records[i], batch: batch},
+		})
+	}
+
+	// a full page may be followed by more sales
+	if n := len(conn.edges); n > 0 && n == filter.PageSize() {
+		conn.pageInfo.hasNextPage = true
+	}
+	if n := len(conn.edges); n > 0 {
+		conn.pageInfo.endCursor = &conn.edges[n-1].cursor
+	}
+
+	return &conn, nil
+}
+
+func (r *resolver) NFT(args struct{ Mint string }) (*nftResolver, error) {
+	records, err := r.reader.Search(reader.Filter{Mint: args.Mint, Limit: 1})
+	switch {
+	case err == nil:
+	case errors.Is(err, sales.ErrNotFound):
+		return nil, nil
+	default:
+		r.logger.Error("unable to get nft sales", zap.Error(err), zap.String("mint", args.Mint))
+		return nil, errInternal
+	}
+
+	return &nftResolver{
+		mint:       args.Mint,
+		nft:        records[0].NFT,
+		collection: records[0].Collection,
+		batch:      newMintBatch(r.logger, r.reader, records),
+		last:       &records[0],
+	}, nil
+}
+
+func (r *resolver) Marketplaces(ctx context.Context, args struct{ Window string }) ([]*marketplaceResolver, error) {
+	window, err := parseWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := loadersFrom(ctx).stats.load(window, "")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for i := range result {
+		for m := range result[i].Marketplaces {
+			if m != "" && !seen[m] {
+				seen[m] = true
+				names = append(names, m)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	resolvers := make([]*marketplaceResolver, 0, len(names))
+	for _, m := range names {
+		resolvers = append(resolvers, &marketplaceResolver{name: m})
+	}
+
+	return resolvers, nil
+}
+
+func (r *resolver) CollectionStats(ctx context.Context, args struct {
+	Collection  *string
+	Marketplace *string
+	Window      string
+}) ([]*statsResolver, error) {
+	window, err := parseWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+	collection := sales.NFTCollection(value(args.Collection))
+
+	var result []stats.Stats
+	if args.Marketplace != nil {
+		result, err = r.stats.Get(window, stats.Filter{Collection: collection, Marketplace: *args.Marketplace})
+		if err != nil {
+			r.logger.Error("unable to get stats", zap.Error(err), zap.String("window", string(window)))
+			return nil, errInternal
+		}
+	} else if result, err = loadersFrom(ctx).stats.load(window, collection); err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*statsResolver, 0, len(result))
+	for i := range result {
+		resolvers = append(resolvers, &statsResolver{stats: result[i]})
+	}
+
+	return resolvers, nil
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
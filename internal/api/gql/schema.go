@@ -0,0 +1,138 @@
+package gql
+
+// schema is the GraphQL schema of the API
+const schema = `
+schema {
+	query: Query
+}
+
+"An RFC 3339 time"
+scalar Time
+
+"An amount of lamports, as a string as it may exceed a 32-bit integer"
+scalar Lamports
+
+type Query {
+	"The sale with the transaction signature"
+	sale(signature: String!): Sale
+
+	"""
+	The sales matching the filter. first is at most 100, after is the
+	endCursor of the previous page.
+	"""
+	sales(filter: SaleFilter, orderBy: SaleOrder = RECENT, first: Int = 50, after: String): SaleConnection!
+
+	"The NFT with the mint address, null when it has never sold"
+	nft(mint: String!): NFT
+
+	"The marketplaces with sales in the window"
+	marketplaces(window: Window = ALL): [Marketplace!]!
+
+	"The statistics of each collection over the window"
+	collectionStats(collection: String, marketplace: String, window: Window = WEEK): [CollectionStats!]!
+}
+
+input SaleFilter {
+	collection: String
+	marketplace: String
+	mint: String
+	buyer: String
+	seller: String
+	minPrice: Lamports
+	maxPrice: Lamports
+	"Inclusive"
+	from: Time
+	"Exclusive"
+	to: Time
+}
+
+enum SaleOrder {
+	"Most recent first"
+	RECENT
+	"Highest price first"
+	PRICE
+}
+
+enum Window {
+	HOUR
+	DAY
+	WEEK
+	MONTH
+	ALL
+}
+
+type Sale {
+	signature: String!
+	collection: String!
+	marketplace: Marketplace
+	nft: NFT!
+	buyer: String!
+	seller: String!
+	price: Price!
+	saleTime: Time
+	createdAt: Time
+	"The statistics of the sale's collection over the window"
+	collectionStats(window: Window = WEEK): CollectionStats
+}
+
+type NFT {
+	mint: String!
+	name: String!
+	symbol: String!
+	metadataURI: String!
+	collection: String!
+	lastSale: Sale
+}
+
+type Marketplace {
+	name: String!
+	"The statistics of each collection on the marketplace over the window"
+	stats(window: Window = WEEK, collection: String): [CollectionStats!]!
+}
+
+type Price {
+	lamports: Lamports!
+	"The price in SOL e.g. 1.5"
+	sol: String!
+}
+
+type CollectionStats {
+	collection: String!
+	window: Window!
+	count: Int!
+	volume: Price!
+	average: Price!
+	median: Price!
+	min: Price!
+	max: Price!
+	uniqueBuyers: Int!
+	marketplaces: [MarketplaceStats!]!
+}
+
+type MarketplaceStats {
+	marketplace: Marketplace!
+	count: Int!
+	volume: Price!
+	average: Price!
+	median: Price!
+	min: Price!
+	max: Price!
+	uniqueBuyers: Int!
+}
+
+type SaleConnection {
+	edges: [SaleEdge!]!
+	pageInfo: PageInfo!
+}
+
+type SaleEdge {
+	cursor: String!
+	node: Sale!
+}
+
+type PageInfo {
+	"True when the page is full, the next page may still be empty"
+	hasNextPage: Boolean!
+	endCursor: String
+}
+`
@@ -0,0 +1,362 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/stats"
+)
+
+// lamports is the Lamports scalar
+type lamports uint64
+
+// ImplementsGraphQLType maps lamports to the Lamports scalar
+func (lamports) ImplementsGraphQLType(name string) bool {
+	return name == "Lamports"
+}
+
+// UnmarshalGraphQL parses lamports given as a string, or as an integer
+func (l *lamports) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		v, err := strconv.ParseUint(input, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid lamports %q", input)
+		}
+		*l = lamports(v)
+		return nil
+	case int32:
+		if input < 0 {
+			return fmt.Errorf("invalid lamports %d", input)
+		}
+		*l = lamports(input)
+		return nil
+	default:
+		return fmt.Errorf("wrong type for Lamports: %T", input)
+	}
+}
+
+// MarshalJSON marshals lamports as a string
+func (l lamports) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(l), 10))
+}
+
+// windows map the Window enum values to the stats windows
+var windows = map[string]stats.Window{
+	"HOUR":  stats.Hour,
+	"DAY":   stats.Day,
+	"WEEK":  stats.Week,
+	"MONTH": stats.Month,
+	"ALL":   stats.AllTime,
+}
+
+func parseWindow(s string) (stats.Window, error) {
+	w, ok := windows[s]
+	if !ok {
+		return "", fmt.Errorf("unknown window %q", s)
+	}
+
+	return w, nil
+}
+
+func windowName(w stats.Window) string {
+	for name, window := range windows {
+		if window == w {
+			return name
+		}
+	}
+
+	return ""
+}
+
+type priceResolver struct {
+	lamports uint64
+}
+
+func (p priceResolver) Lamports() lamports {
+	return lamports(p.lamports)
+}
+
+func (p priceResolver) SOL() string {
+	return sales.FormatSOL(p.lamports)
+}
+
+// saleResolver resolves a sale, the batch is that of the sales resolved along
+// with it e.g. the page of sales
+type saleResolver struct {
+	rec   sales.Record
+	batch *mintBatch
+}
+
+func (s *saleResolver) Signature() string {
+	return s.rec.ID
+}
+
+func (s *saleResolver) Collection() string {
+	return string(s.rec.Collection)
+}
+
+func (s *saleResolver) Marketplace() *marketplaceResolver {
+	if s.rec.Marketplace == "" {
+		return nil
+	}
+
+	return &marketplaceResolver{name: s.rec.Marketplace}
+}
+
+func (s *saleResolver) NFT() *nftResolver {
+	return &nftResolver{
+		mint:       s.rec.MintPubkey,
+		nft:        s.rec.NFT,
+		collection: s.rec.Collection,
+		batch:      s.batch,
+	}
+}
+
+func (s *saleResolver) Buyer() string {
+	return s.rec.Buyer
+}
+
+func (s *saleResolver) Seller() string {
+	return s.rec.Seller
+}
+
+func (s *saleResolver) Price() priceResolver {
+	return priceResolver{lamports: s.rec.Price}
+}
+
+func (s *saleResolver) SaleTime() *graphql.Time {
+	if s.rec.SaleTime == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *s.rec.SaleTime}
+}
+
+func (s *saleResolver) CreatedAt() *graphql.Time {
+	if s.rec.CreatedAt == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *s.rec.CreatedAt}
+}
+
+func (s *saleResolver) CollectionStats(ctx context.Context, args struct{ Window string }) (*statsResolver, error) {
+	window, err := parseWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stats of every collection are loaded once for every sale
+	result, err := loadersFrom(ctx).stats.load(window, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if result[i].Collection == s.rec.Collection {
+			return &statsResolver{stats: result[i]}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// nftResolver resolves an NFT from one of its sales. The last sale is loaded
+// along with those of the other NFTs of the batch, unless it is known.
+type nftResolver struct {
+	mint       string
+	nft        sales.NFT
+	collection sales.NFTCollection
+	batch      *mintBatch
+	last       *sales.Record
+}
+
+func (n *nftResolver) Mint() string {
+	return n.mint
+}
+
+func (n *nftResolver) Name() string {
+	return n.nft.Name
+}
+
+func (n *nftResolver) Symbol() string {
+	return n.nft.Symbol
+}
+
+func (n *nftResolver) MetadataURI() string {
+	return n.nft.MetadataURI
+}
+
+func (n *nftResolver) Collection() string {
+	return string(n.collection)
+}
+
+func (n *nftResolver) LastSale() (*saleResolver, error) {
+	if n.last != nil {
+		return &saleResolver{rec: *n.last, batch: n.batch}, nil
+	}
+
+	rec, err := n.batch.load(n.mint)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+
+	return &saleResolver{rec: *rec, batch: n.batch}, nil
+}
+
+type marketplaceResolver struct {
+	name string
+}
+
+func (m *marketplaceResolver) Name() string {
+	return m.name
+}
+
+func (m *marketplaceResolver) Stats(ctx context.Context, args struct {
+	Window     string
+	Collection *string
+}) ([]*statsResolver, error) {
+	window, err := parseWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection sales.NFTCollection
+	if args.Collection != nil {
+		collection = sales.NFTCollection(*args.Collection)
+	}
+
+	// the stats of every marketplace are loaded once for every marketplace
+	result, err := loadersFrom(ctx).stats.load(window, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolvers []*statsResolver
+	for i := range result {
+		summary, ok := result[i].Marketplaces[m.name]
+		if !ok {
+			continue
+		}
+		resolvers = append(resolvers, &statsResolver{stats: stats.Stats{
+			Collection: result[i].Collection,
+			Window:     result[i].Window,
+			Summary:    summary,
+		}})
+	}
+
+	return resolvers, nil
+}
+
+type statsResolver struct {
+	stats stats.Stats
+}
+
+func (s *statsResolver) Collection() string {
+	return string(s.stats.Collection)
+}
+
+func (s *statsResolver) Window() string {
+	return windowName(s.stats.Window)
+}
+
+func (s *statsResolver) Count() int32 {
+	return int32(s.stats.Summary.Count)
+}
+
+func (s *statsResolver) Volume() priceResolver {
+	return priceResolver{lamports: s.stats.Summary.Volume}
+}
+
+func (s *statsResolver) Average() priceResolver {
+	return priceResolver{lamports: s.stats.Summary.Average}
+}
+
+func (s *statsResolver) Median() priceResolver {
+	return priceResolver{lamports: s.stats.Summary.Median}
+}
+
+func (s *statsResolver) Min() priceResolver {
+	return priceResolver{lamports: s.stats.Summary.Min}
+}
+
+func (s *statsResolver) Max() priceResolver {
+	return priceResolver{lamports: s.stats.Summary.Max}
+}
+
+func (s *statsResolver) UniqueBuyers() int32 {
+	return int32(s.stats.Summary.UniqueBuyers)
+}
+
+// Marketplaces returns the stats by marketplace, ordered by name
+func (s *statsResolver) Marketplaces() []*marketplaceStatsResolver {
+	names := make([]string, 0, len(s.stats.Marketplaces))
+	for m := range s.stats.Marketplaces {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+
+	resolvers := make([]*marketplaceStatsResolver, 0, len(names))
+	for _, m := range names {
+		resolvers = append(resolvers, &marketplaceStatsResolver{
+			marketplace:   m,
+			statsResolver: statsResolver{stats: stats.Stats{Summary: s.stats.Marketplaces[m]}},
+		})
+	}
+
+	return resolvers
+}
+
+type marketplaceStatsResolver struct {
+	marketplace string
+	statsResolver
+}
+
+func (m *marketplaceStatsResolver) Marketplace() *marketplaceResolver {
+	return &marketplaceResolver{name: m.marketplace}
+}
+
+type saleConnectionResolver struct {
+	edges    []*saleEdgeResolver
+	pageInfo pageInfoResolver
+}
+
+func (c *saleConnectionResolver) Edges() []*saleEdgeResolver {
+	return c.edges
+}
+
+func (c *saleConnectionResolver) PageInfo() pageInfoResolver {
+	return c.pageInfo
+}
+
+type saleEdgeResolver struct {
+	cursor string
+	node   *saleResolver
+}
+
+func (e *saleEdgeResolver) Cursor() string {
+	return e.cursor
+}
+
+func (e *saleEdgeResolver) Node() *saleResolver {
+	return e.node
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (p pageInfoResolver) HasNextPage() bool {
+	return p.hasNextPage
+}
+
+func (p pageInfoResolver) EndCursor() *string {
+	return p.endCursor
+}
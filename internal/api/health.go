@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"bromato-sales/internal/health"
+)
+
+// readyTimeout bounds the dependency checks of a readiness probe
+const readyTimeout = time.Second * 15
+
+// healthz handles GET /healthz, it fails when the tracker is stale
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, s.health.Live())
+}
+
+// readyz handles GET /readyz, it fails when a dependency of the tracker is
+// unavailable or the tracker is stale
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	writeReport(w, s.health.Ready(ctx))
+}
+
+func writeReport(w http.ResponseWriter, report health.Report) {
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+// defaultLeaderboardLimit is the number of sales on the leaderboard unless a
+// limit is given
+const defaultLeaderboardLimit = 10
+
+// leaderboardResponse are the top sales of a window, highest price first
+type leaderboardResponse struct {
+	Window string             `json:"window"`
+	Sales  []leaderboardEntry `json:"sales"`
+}
+
+type leaderboardEntry struct {
+	Rank int `json:"rank"`
+	saleResponse
+}
+
+// getLeaderboard handles GET /leaderboard. The window defaults to the past
+// week.
+func (s *Server) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	window := stats.Week
+	if v := q.Get("window"); v != "" {
+		var err error
+		if window, err = stats.ParseWindow(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	limit := defaultLeaderboardLimit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > reader.MaxSearchLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit, must be between 1 and %d", reader.MaxSearchLimit))
+			return
+		}
+	}
+
+	records, err := s.reader.TopSales(reader.Filter{
+		Collection:  sales.NFTCollection(q.Get("collection")),
+		Marketplace: q.Get("marketplace"),
+		From:        window.Since(time.Now()),
+		Limit:       limit,
+	})
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		s.logger.Error("unable to get top sales", zap.Error(err), zap.String("window", string(window)))
+		writeError(w, http.StatusInternalServerError, "unable to get leaderboard")
+		return
+	}
+
+	resp := leaderboardResponse{Window: string(window), Sales: make([]leaderboardEntry, 0, len(records))}
+	for i := range records {
+		resp.Sales = append(resp.Sales, leaderboardEntry{Rank: i + 1, saleResponse: newSaleResponse(records[i])})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
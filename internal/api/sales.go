@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/reader"
+)
+
+// saleResponse is a sale as returned by the API
+type saleResponse struct {
+	Signature   string        `json:"signature"`
+	Collection  string        `json:"collection"`
+	Marketplace string        `json:"marketplace"`
+	Mint        string        `json:"mint"`
+	NFT         nftResponse   `json:"nft"`
+	Buyer       string        `json:"buyer"`
+	Seller      string        `json:"seller"`
+	Price       priceResponse `json:"price"`
+	SaleTime    *time.Time    `json:"saleTime"`
+	CreatedAt   *time.Time    `json:"createdAt"`
+}
+
+type nftResponse struct {
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	MetadataURI string `json:"metadataURI"`
+}
+
+// priceResponse is a price in lamports and formatted as SOL e.g. "1.5"
+type priceResponse struct {
+	Lamports uint64 `json:"lamports"`
+	SOL      string `json:"sol"`
+}
+
+// salesResponse is a page of sales, NextCursor is empty on the last page
+type salesResponse struct {
+	Sales      []saleResponse `json:"sales"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+func newSaleResponse(rec sales.Record) saleResponse {
+	return saleResponse{
+		Signature:   rec.ID,
+		Collection:  string(rec.Collection),
+		Marketplace: rec.Marketplace,
+		Mint:        rec.MintPubkey,
+		NFT: nftResponse{
+			Name:        rec.NFT.Name,
+			Symbol:      rec.NFT.Symbol,
+			MetadataURI: rec.NFT.MetadataURI,
+		},
+		Buyer:     rec.Buyer,
+		Seller:    rec.Seller,
+		Price:     newPriceResponse(rec.Price),
+		SaleTime:  rec.SaleTime,
+		CreatedAt: rec.CreatedAt,
+	}
+}
+
+func newPriceResponse(lamports uint64) priceResponse {
+	return priceResponse{Lamports: lamports, SOL: sales.FormatSOL(lamports)}
+}
+
+// listSales handles GET /sales
+func (s *Server) listSales(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.search(w, filter)
+}
+
+// getSale handles GET /sales/{signature}
+func (s *Server) getSale(w http.ResponseWriter, r *http.Request) {
+	signature := strings.TrimPrefix(r.URL.Path, "/sales/")
+	if signature == "" || strings.Contains(signature, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	rec, err := s.reader.Get(signature)
+	switch {
+	case err == nil:
+	case errors.Is(err, sales.ErrNotFound):
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	default:
+		s.logger.Error("unable to get sale", zap.Error(err), zap.String("saleId", signature))
+		writeError(w, http.StatusInternalServerError, "unable to get sale")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSaleResponse(*rec))
+}
+
+// listNFTSales handles GET /nfts/{mint}/sales
+func (s *Server) listNFTSales(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/nfts/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "sales" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Mint = parts[0]
+
+	s.search(w, filter)
+}
+
+func (s *Server) search(w http.ResponseWriter, filter reader.Filter) {
+	records, err := s.reader.Search(filter)
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		s.logger.Error("unable to search sales", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "unable to search sales")
+		return
+	}
+
+	resp := salesResponse{Sales: make([]saleResponse, 0, len(records))}
+	for i := range records {
+		resp.Sales = append(resp.Sales, newSaleResponse(records[i]))
+	}
+
+	// a full page may be followed by more sales
+	if n := len(records); n > 0 && n == filter.PageSize() {
+		resp.NextCursor = encodeCursor(reader.CursorOf(records[n-1]))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseFilter parses the query parameters of the sales listings. Prices are
+// in lamports and times in RFC 3339.
+func parseFilter(q url.Values) (reader.Filter, error) {
+	filter := reader.Filter{
+		Collection:  sales.NFTCollection(q.Get("collection")),
+		Marketplace: q.Get("marketplace"),
+		Buyer:       q.Get("buyer"),
+		Seller:      q.Get("seller"),
+	}
+
+	var err error
+	if filter.MinPrice, err = parseLamports(q, "minPrice"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parseLamports(q, "maxPrice"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = parseTime(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTime(q, "to"); err != nil {
+		return filter, err
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > reader.MaxSearchLimit {
+			return filter, fmt.Errorf("invalid limit, must be between 1 and %d", reader.MaxSearchLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if filter.After, err = decodeCursor(v); err != nil {
+			return filter, errors.New("invalid cursor")
+		}
+	}
+
+	return filter, nil
+}
+
+func parseLamports(q url.Values, key string) (*uint64, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	lamports, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, must be a price in lamports", key)
+	}
+
+	return &lamports, nil
+}
+
+func parseTime(q url.Values, key string) (*time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, must be an RFC 3339 time", key)
+	}
+
+	return &t, nil
+}
+
+// encodeCursor encodes the cursor as an opaque string
+func encodeCursor(c *reader.Cursor) string {
+	return encodeTimeID(c.SaleTime, c.ID)
+}
+
+func decodeCursor(s string) (*reader.Cursor, error) {
+	t, id, err := decodeTimeID(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader.Cursor{SaleTime: t, ID: id}, nil
+}
+
+// encodeTimeID encodes the position of a sale, a time and the sale ID, as an
+// opaque string
+func encodeTimeID(t time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeTimeID(s string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", errors.New("malformed position")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return t, parts[1], nil
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/api/gql"
+	"bromato-sales/internal/health"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+// shutdownTimeout is the time given to in flight requests on shutdown
+const shutdownTimeout = time.Second * 2
+
+// Server serves the HTTP API over the stored sales
+type Server struct {
+	addr     string
+	bus      *events.Bus
+	graphql  *gql.Handler
+	health   *health.Checker
+	logger   *zap.Logger
+	mux      *http.ServeMux
+	reader   *reader.Service
+	stats    *stats.Service
+	streamer *streamer
+}
+
+// Config is the configuration of the server
+type Config struct {
+	// Addr is the address the server listens on e.g. :8080
+	Addr string
+}
+
+func NewServer(
+	logger *zap.Logger,
+	r *reader.Service,
+	st *stats.Service,
+	bus *events.Bus,
+	checker *health.Checker,
+	cfg Config) (*Server, error) {
+	s := Server{
+		addr:   cfg.Addr,
+		bus:    bus,
+		health: checker,
+		logger: logger,
+		mux:    http.NewServeMux(),
+		reader: r,
+		stats:  st,
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	s.logger = s.logger.With(zap.String("component", "api"))
+	s.streamer = &streamer{
+		bus:     s.bus,
+		logger:  s.logger,
+		reader:  s.reader,
+		clients: make(map[*streamClient]struct{}),
+	}
+
+	h, err := gql.NewHandler(s.logger, s.reader, s.stats)
+	if err != nil {
+		return nil, err
+	}
+	s.graphql = h
+	s.routes()
+
+	return &s, nil
+}
+
+func (s *Server) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return s.logger != nil },
+		},
+		{
+			dep: "reader",
+			chk: func() bool { return s.reader != nil },
+		},
+		{
+			dep: "stats",
+			chk: func() bool { return s.stats != nil },
+		},
+		{
+			dep: "bus",
+			chk: func() bool { return s.bus != nil },
+		},
+		{
+			dep: "health",
+			chk: func() bool { return s.health != nil },
+		},
+		{
+			dep: "addr",
+			chk: func() bool { return s.addr != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize api server due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("/sales", get(s.listSales))
+	s.mux.HandleFunc("/sales/", get(s.getSale))
+	s.mux.HandleFunc("/nfts/", get(s.listNFTSales))
+	s.mux.HandleFunc("/stats", get(s.getStats))
+	s.mux.HandleFunc("/leaderboard", get(s.getLeaderboard))
+	s.mux.HandleFunc("/stream", get(s.streamSales))
+	s.mux.HandleFunc("/stream/ws", get(s.streamSalesWS))
+	s.mux.Handle("/graphql", s.graphql)
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc("/healthz", get(s.healthz))
+	s.mux.HandleFunc("/readyz", get(s.readyz))
+}
+
+// ServeHTTP serves the API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Run serves the API until the context is done
+func (s *Server) Run(ctx context.Context) error {
+	srv := http.Server{
+		Addr:              s.addr,
+		Handler:           s,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	// the streams end once the streamer stops, as the shutdown doesn't wait
+	// for them
+	go s.streamer.run(ctx)
+
+	errc := make(chan error, 1)
+	go func() {
+		s.logger.Info("serving api", zap.String("addr", s.addr))
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		const msg = "unable to serve api"
+		s.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Warn("unable to shutdown api gracefully", zap.Error(err))
+	}
+
+	return nil
+}
+
+// get restricts the handler to GET and HEAD requests
+func get(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/stats"
+)
+
+// statsResponse are the statistics of a collection over a window
+type statsResponse struct {
+	Collection string `json:"collection"`
+	Window     string `json:"window"`
+	summaryResponse
+	Marketplaces map[string]summaryResponse `json:"marketplaces"`
+}
+
+type summaryResponse struct {
+	Count        int           `json:"count"`
+	Volume       priceResponse `json:"volume"`
+	Average      priceResponse `json:"average"`
+	Median       priceResponse `json:"median"`
+	Min          priceResponse `json:"min"`
+	Max          priceResponse `json:"max"`
+	UniqueBuyers int           `json:"uniqueBuyers"`
+}
+
+func newSummaryResponse(s stats.Summary) summaryResponse {
+	return summaryResponse{
+		Count:        s.Count,
+		Volume:       newPriceResponse(s.Volume),
+		Average:      newPriceResponse(s.Average),
+		Median:       newPriceResponse(s.Median),
+		Min:          newPriceResponse(s.Min),
+		Max:          newPriceResponse(s.Max),
+		UniqueBuyers: s.UniqueBuyers,
+	}
+}
+
+// getStats handles GET /stats. The windows are given as a comma separated
+// list e.g. window=24h,7d and default to every window.
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := stats.Filter{
+		Collection:  sales.NFTCollection(q.Get("collection")),
+		Marketplace: q.Get("marketplace"),
+	}
+
+	windows := stats.Windows
+	if v := q.Get("window"); v != "" {
+		windows = nil
+		for _, p := range strings.Split(v, ",") {
+			window, err := stats.ParseWindow(strings.TrimSpace(p))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			windows = append(windows, window)
+		}
+	}
+
+	resp := struct {
+		Stats []statsResponse `json:"stats"`
+	}{Stats: []statsResponse{}}
+	for _, window := range windows {
+		result, err := s.stats.Get(window, filter)
+		if err != nil {
+			s.logger.Error("unable to get stats", zap.Error(err), zap.String("window", string(window)))
+			writeError(w, http.StatusInternalServerError, "unable to get stats")
+			return
+		}
+
+		for _, st := range result {
+			sr := statsResponse{
+				Collection:      string(st.Collection),
+				Window:          string(st.Window),
+				summaryResponse: newSummaryResponse(st.Summary),
+				Marketplaces:    make(map[string]summaryResponse, len(st.Marketplaces)),
+			}
+			for m, summary := range st.Marketplaces {
+				sr.Marketplaces[m] = newSummaryResponse(summary)
+			}
+			resp.Stats = append(resp.Stats, sr)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/reader"
+)
+
+const (
+	// streamPollInterval is how often the store is polled for new sales, sales
+	// detected by this replica are streamed as soon as they are detected
+	streamPollInterval = time.Second * 5
+
+	// heartbeatInterval is how often idle streams are sent a heartbeat so that
+	// clients, and proxies, don't time them out
+	heartbeatInterval = time.Second * 15
+
+	// maxReplay is the number of missed sales replayed to a resuming client,
+	// clients missing more sales must catch up with the sales listing
+	maxReplay = 1000
+
+	// streamClientBuffer is the number of sales held for a client before it is
+	// disconnected as too slow
+	streamClientBuffer = 64
+
+	wsWriteTimeout = time.Second * 10
+)
+
+// upgrader accepts websockets from any origin, the stream is public and read
+// only so that any website may embed it
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamer fans the newly created sales out to the stream clients. The store
+// is polled for new sales, rather than relying on the event bus alone, as only
+// the replica saving new sales emits them while every replica serves the API.
+type streamer struct {
+	bus    *events.Bus
+	logger *zap.Logger
+	reader *reader.Service
+
+	mu      sync.Mutex
+	clients map[*streamClient]struct{}
+	closed  bool
+}
+
+// streamClient is a connected stream, its sales channel is closed when the
+// client is disconnected by the streamer
+type streamClient struct {
+	collections map[sales.NFTCollection]bool
+	sales       chan sales.Record
+}
+
+func (c *streamClient) matches(rec sales.Record) bool {
+	return len(c.collections) == 0 || c.collections[rec.Collection]
+}
+
+// run streams the new sales until the context is done, then disconnects every
+// client
+func (st *streamer) run(ctx context.Context) {
+	sub := st.bus.Subscribe("stream", 64)
+	defer sub.Close()
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	last := reader.Position{CreatedAt: time.Now().UTC()}
+	for {
+		select {
+		case <-ctx.Done():
+			st.close()
+			return
+		case <-ticker.C:
+		case e := <-sub.Events():
+			if _, ok := e.(events.SaleDetected); !ok {
+				continue
+			}
+		}
+
+		last = st.poll(last)
+	}
+}
+
+// poll broadcasts the sales created after the position, returning the
+// position of the last sale broadcast
+func (st *streamer) poll(last reader.Position) reader.Position {
+	for {
+		records, err := st.reader.CreatedAfter(last, nil, reader.MaxSearchLimit)
+		if err != nil {
+			if !errors.Is(err, sales.ErrNotFound) {
+				st.logger.Error("unable to poll new sales", zap.Error(err))
+			}
+			return last
+		}
+
+		for i := range records {
+			st.broadcast(records[i])
+			last = *reader.PositionOf(records[i])
+		}
+
+		if len(records) < reader.MaxSearchLimit {
+			return last
+		}
+	}
+}
+
+func (st *streamer) broadcast(rec sales.Record) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for c := range st.clients {
+		if !c.matches(rec) {
+			continue
+		}
+
+		select {
+		case c.sales <- rec:
+		default:
+			// the client resumes from its last sale when it reconnects
+			st.logger.Warn("disconnecting slow stream client")
+			delete(st.clients, c)
+			close(c.sales)
+		}
+	}
+}
+
+// subscribe connects a client streaming the sales of the collections, every
+// collection when empty
+func (st *streamer) subscribe(collections []sales.NFTCollection) (*streamClient, error) {
+	c := streamClient{
+		collections: make(map[sales.NFTCollection]bool, len(collections)),
+		sales:       make(chan sales.Record, streamClientBuffer),
+	}
+	for _, collection := range collections {
+		c.collections[collection] = true
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return nil, errors.New("stream closed")
+	}
+	st.clients[&c] = struct{}{}
+
+	return &c, nil
+}
+
+// unsubscribe disconnects the client, if the streamer hasn't already
+func (st *streamer) unsubscribe(c *streamClient) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.clients[c]; ok {
+		delete(st.clients, c)
+		close(c.sales)
+	}
+}
+
+func (st *streamer) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.closed = true
+	for c := range st.clients {
+		delete(st.clients, c)
+		close(c.sales)
+	}
+}
+
+// streamWriter writes the stream messages in the format of the transport
+type streamWriter interface {
+	writeSale(id string, sale saleResponse) error
+	writeHeartbeat() error
+}
+
+// streamSales handles GET /stream, streaming new sales as server-sent events.
+// The collection parameter filters the sales by a comma separated list of
+// collections. Reconnecting clients resume from their Last-Event-ID.
+func (s *Server) streamSales(w http.ResponseWriter, r *http.Request) {
+	collections, resume, err := parseStream(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// stops nginx buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	flusher.Flush()
+
+	s.stream(r.Context(), sseWriter{w: w, flusher: flusher}, collections, resume)
+}
+
+// streamSalesWS handles GET /stream/ws, streaming new sales as websocket
+// messages. The parameters are those of /stream, the Last-Event-ID is given
+// as the lastEventId parameter as browsers can't set websocket headers.
+func (s *Server) streamSalesWS(w http.ResponseWriter, r *http.Request) {
+	collections, resume, err := parseStream(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the upgrader responds to failed upgrades
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Debug("unable to upgrade websocket", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	// messages from the client are discarded, reading handles the control
+	// messages and notices the client closing
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s.stream(ctx, wsWriter{conn: conn}, collections, resume)
+
+	_ = conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+		time.Now().Add(wsWriteTimeout),
+	)
+}
+
+// stream replays the sales created after resume, when given, then streams new
+// sales until the client disconnects or is disconnected
+func (s *Server) stream(ctx context.Context, w streamWriter, collections []sales.NFTCollection, resume *reader.Position) {
+	// subscribe before replaying so that no sale falls in between, sales both
+	// replayed and streamed are only written once
+	client, err := s.streamer.subscribe(collections)
+	if err != nil {
+		return
+	}
+	defer s.streamer.unsubscribe(client)
+
+	var last *reader.Position
+	if resume != nil {
+		if last, err = s.replay(w, collections, *resume); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := w.writeHeartbeat(); err != nil {
+				return
+			}
+		case rec, ok := <-client.sales:
+			if !ok {
+				return
+			}
+
+			p := reader.PositionOf(rec)
+			if last != nil && !positionAfter(*p, *last) {
+				continue
+			}
+			if err := w.writeSale(encodeTimeID(p.CreatedAt, p.ID), newSaleResponse(rec)); err != nil {
+				return
+			}
+			last = p
+		}
+	}
+}
+
+// replay writes up to maxReplay sales created after the position, returning
+// the position of the last sale written
+func (s *Server) replay(w streamWriter, collections []sales.NFTCollection, last reader.Position) (*reader.Position, error) {
+	for replayed := 0; replayed < maxReplay; {
+		records, err := s.reader.CreatedAfter(last, collections, reader.MaxSearchLimit)
+		if errors.Is(err, sales.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			s.logger.Error("unable to replay sales", zap.Error(err))
+			return nil, err
+		}
+
+		for i := range records {
+			p := reader.PositionOf(records[i])
+			if err := w.writeSale(encodeTimeID(p.CreatedAt, p.ID), newSaleResponse(records[i])); err != nil {
+				return nil, err
+			}
+			last = *p
+		}
+
+		replayed += len(records)
+		if len(records) < reader.MaxSearchLimit {
+			break
+		}
+	}
+
+	return &last, nil
+}
+
+// positionAfter reports whether p is after q, at the millisecond precision
+// the store compares creation times at
+func positionAfter(p reader.Position, q reader.Position) bool {
+	pm, qm := p.CreatedAt.UnixNano()/int64(time.Millisecond), q.CreatedAt.UnixNano()/int64(time.Millisecond)
+	return pm > qm || (pm == qm && p.ID > q.ID)
+}
+
+// parseStream parses the collections and the position to resume from of a
+// stream request
+func parseStream(r *http.Request) ([]sales.NFTCollection, *reader.Position, error) {
+	var collections []sales.NFTCollection
+	if v := r.URL.Query().Get("collection"); v != "" {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				collections = append(collections, sales.NFTCollection(c))
+			}
+		}
+	}
+
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("lastEventId")
+	}
+	if id == "" {
+		return collections, nil, nil
+	}
+
+	t, saleID, err := decodeTimeID(id)
+	if err != nil {
+		return nil, nil, errors.New("invalid last event id")
+	}
+
+	return collections, &reader.Position{CreatedAt: t, ID: saleID}, nil
+}
+
+// sseWriter writes server-sent events
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (w sseWriter) writeSale(id string, sale saleResponse) error {
+	b, err := json.Marshal(sale)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w.w, "id: %s\nevent: sale\ndata: %s\n\n", id, b); err != nil {
+		return err
+	}
+	w.flusher.Flush()
+
+	return nil
+}
+
+func (w sseWriter) writeHeartbeat() error {
+	if _, err := fmt.Fprint(w.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	w.flusher.Flush()
+
+	return nil
+}
+
+// wsMessage is a websocket message, Type is sale or heartbeat
+type wsMessage struct {
+	Type string        `json:"type"`
+	ID   string        `json:"id,omitempty"`
+	Sale *saleResponse `json:"sale,omitempty"`
+}
+
+// wsWriter writes websocket messages
+type wsWriter struct {
+	conn *websocket.Conn
+}
+
+func (w wsWriter) writeSale(id string, sale saleResponse) error {
+	return w.write(wsMessage{Type: "sale", ID: id, Sale: &sale})
+}
+
+func (w wsWriter) writeHeartbeat() error {
+	return w.write(wsMessage{Type: "heartbeat"})
+}
+
+func (w wsWriter) write(msg wsMessage) error {
+	if err := w.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+
+	return w.conn.WriteJSON(msg)
+}
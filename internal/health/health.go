@@ -0,0 +1,375 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/metrics"
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/publisher"
+)
+
+const (
+	// pingTimeout bounds the checks of couchbase and the rpc node
+	pingTimeout = time.Second * 3
+
+	// verifyTimeout bounds the verification of a publisher's credentials
+	verifyTimeout = time.Second * 10
+)
+
+// Status is the status of a check, or of every check
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// Report is the result of the checks, failing when any check failed
+type Report struct {
+	Status Status           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// OK returns whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Check is the result of a check
+type Check struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Detail explains a passing check that wasn't fully run e.g. the ingestion
+	// of a standby replica
+	Detail string `json:"detail,omitempty"`
+
+	// LastSuccess is the time of the last successful run of the tracker's
+	// runs, SinceLastSuccess the seconds since, or since the replica started
+	// running the tracker when the run hasn't succeeded yet
+	LastSuccess      *time.Time `json:"lastSuccess,omitempty"`
+	SinceLastSuccess *float64   `json:"sinceLastSuccess,omitempty"`
+
+	// VerifiedAt is when the credentials of a publisher were last verified
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+}
+
+// Leadership tells whether the replica runs the tracker, when leader election
+// is enabled
+type Leadership interface {
+	// Leading returns whether the replica leads, and since when
+	Leading() (time.Time, bool)
+}
+
+// Checker checks the health of the tracker and of its dependencies
+type Checker struct {
+	bucket         string
+	channels       []sales.PublishChannel
+	cluster        *gocb.Cluster
+	leadership     Leadership
+	logger         *zap.Logger
+	solClient      *rpc.Client
+	staleAfter     time.Duration
+	started        time.Time
+	verifiers      []publisher.Verifier
+	verifyInterval time.Duration
+	verification   map[sales.PublishChannel]*verification
+}
+
+// verification is the last verification of a publisher's credentials
+type verification struct {
+	mu         sync.Mutex
+	err        error
+	verifiedAt time.Time
+}
+
+// Config is the configuration of the checker
+type Config struct {
+	// Bucket is the bucket pinged to check couchbase
+	Bucket string
+
+	// StaleAfter is how long ingestion and publishing may go without
+	// succeeding before the tracker is stale
+	StaleAfter time.Duration
+
+	// VerifyInterval is how long the credentials of the publishers are
+	// trusted once verified, verifying them on every check would eat into
+	// their rate limits
+	VerifyInterval time.Duration
+
+	// Leadership, when set, tells whether the replica runs the tracker. The
+	// tracker of a standby replica is never stale.
+	Leadership Leadership
+
+	// Channels are the channels published to, each must publish within the
+	// stale threshold
+	Channels []sales.PublishChannel
+}
+
+func NewChecker(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	solClient *rpc.Client,
+	verifiers []publisher.Verifier,
+	cfg Config) (*Checker, error) {
+	c := Checker{
+		bucket:         cfg.Bucket,
+		channels:       cfg.Channels,
+		cluster:        cluster,
+		leadership:     cfg.Leadership,
+		logger:         logger,
+		solClient:      solClient,
+		staleAfter:     cfg.StaleAfter,
+		started:        time.Now(),
+		verifiers:      verifiers,
+		verifyInterval: cfg.VerifyInterval,
+		verification:   make(map[sales.PublishChannel]*verification, len(verifiers)),
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range c.verifiers {
+		c.verification[v.Channel()] = &verification{}
+	}
+
+	return &c, nil
+}
+
+func (c *Checker) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return c.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return c.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return c.bucket != "" },
+		},
+		{
+			dep: "solClient",
+			chk: func() bool { return c.solClient != nil },
+		},
+		{
+			dep: "staleAfter",
+			chk: func() bool { return c.staleAfter > 0 },
+		},
+		{
+			dep: "verifyInterval",
+			chk: func() bool { return c.verifyInterval > 0 },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize health checker due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Live checks that the tracker isn't stale, without checking its
+// dependencies nor the channels, restarting the tracker doesn't fix a
+// failing channel
+func (c *Checker) Live() Report {
+	checks := map[string]Check{
+		"ingestion":  c.checkRun(metrics.Ingestion),
+		"publishing": c.checkRun(metrics.Publishing),
+	}
+
+	return newReport(checks)
+}
+
+// Ready checks the dependencies of the tracker, couchbase, the rpc node and
+// the credentials of the publishers, that the tracker isn't stale and that
+// every channel published within the stale threshold
+func (c *Checker) Ready(ctx context.Context) Report {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		checks = map[string]Check{
+			"ingestion":  c.checkRun(metrics.Ingestion),
+			"publishing": c.checkRun(metrics.Publishing),
+		}
+	)
+	for _, channel := range c.channels {
+		run := metrics.PublishingTo(string(channel))
+		checks[string(run)] = c.checkRun(run)
+	}
+
+	run := func(name string, check func(ctx context.Context) Check) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := check(ctx)
+
+			mu.Lock()
+			checks[name] = result
+			mu.Unlock()
+		}()
+	}
+
+	run("couchbase", c.checkCouchbase)
+	run("rpc", c.checkRPC)
+	for _, v := range c.verifiers {
+		v := v
+		run("publisher."+string(v.Channel()), func(ctx context.Context) Check {
+			return c.checkPublisher(ctx, v)
+		})
+	}
+	wg.Wait()
+
+	return newReport(checks)
+}
+
+// checkRun fails when the run hasn't succeeded within the stale threshold,
+// counting from when the replica started running the tracker
+func (c *Checker) checkRun(run metrics.Run) Check {
+	since := c.started
+	if c.leadership != nil {
+		leadingSince, ok := c.leadership.Leading()
+		if !ok {
+			return Check{Status: StatusOK, Detail: "standing by, another replica runs the tracker"}
+		}
+		if leadingSince.After(since) {
+			since = leadingSince
+		}
+	}
+
+	check := Check{Status: StatusOK}
+	if last := metrics.LastSucceeded(run); !last.IsZero() {
+		check.LastSuccess = &last
+		if last.After(since) {
+			since = last
+		}
+	}
+
+	age := time.Since(since)
+	seconds := age.Seconds()
+	check.SinceLastSuccess = &seconds
+	if age > c.staleAfter {
+		check.Status = StatusFail
+		check.Error = fmt.Sprintf("no successful %s for %s", run, age.Truncate(time.Second))
+	}
+
+	return check
+}
+
+// checkCouchbase pings the key value and query services of the bucket
+func (c *Checker) checkCouchbase(ctx context.Context) Check {
+	res, err := c.cluster.Bucket(c.bucket).Ping(&gocb.PingOptions{
+		ServiceTypes: []gocb.ServiceType{gocb.ServiceTypeKeyValue, gocb.ServiceTypeQuery},
+		Timeout:      pingTimeout,
+		Context:      ctx,
+	})
+	if err != nil {
+		c.logger.Warn("unable to ping couchbase", zap.Error(err))
+		return failed(err)
+	}
+
+	for _, endpoints := range res.Services {
+		if len(endpoints) == 0 {
+			return failed(errors.New("no endpoint of a service is available"))
+		}
+		for _, e := range endpoints {
+			if e.State != gocb.PingStateOk {
+				c.logger.Warn("couchbase endpoint is unhealthy", zap.String("remote", e.Remote), zap.String("error", e.Error))
+				return failed(fmt.Errorf("endpoint %s is unhealthy: %s", e.Remote, e.Error))
+			}
+		}
+	}
+
+	return Check{Status: StatusOK}
+}
+
+// checkRPC checks the health of the rpc node
+func (c *Checker) checkRPC(ctx context.Context) Check {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	var health string
+	err := metrics.ObserveRPC("getHealth", func() (err error) {
+		health, err = c.solClient.GetHealth(ctx)
+		return err
+	})
+	switch {
+	case err != nil:
+		c.logger.Warn("unable to get rpc health", zap.Error(err))
+		return failed(err)
+	case health != rpc.HealthOk:
+		return failed(fmt.Errorf("rpc node is %s", health))
+	}
+
+	return Check{Status: StatusOK}
+}
+
+// checkPublisher verifies the credentials of the publisher, unless verified
+// within the verify interval
+func (c *Checker) checkPublisher(ctx context.Context, v publisher.Verifier) Check {
+	last := c.verification[v.Channel()]
+
+	last.mu.Lock()
+	defer last.mu.Unlock()
+
+	if last.verifiedAt.IsZero() || time.Since(last.verifiedAt) > c.verifyInterval {
+		ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+		defer cancel()
+
+		err := v.Verify(ctx)
+		if errors.Is(err, context.Canceled) {
+			// the check was abandoned, not failed
+			return failed(err)
+		}
+		last.err, last.verifiedAt = err, time.Now()
+	}
+
+	verifiedAt := last.verifiedAt
+	if last.err != nil {
+		check := failed(last.err)
+		check.VerifiedAt = &verifiedAt
+		return check
+	}
+
+	return Check{Status: StatusOK, VerifiedAt: &verifiedAt}
+}
+
+func failed(err error) Check {
+	return Check{Status: StatusFail, Error: err.Error()}
+}
+
+func newReport(checks map[string]Check) Report {
+	r := Report{Status: StatusOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != StatusOK {
+			r.Status = StatusFail
+		}
+	}
+
+	return r
+}
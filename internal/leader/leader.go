@@ -0,0 +1,309 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	// CouchbaseCollection is the Couchbase collection, in the sales scope, in
+	// which the leases are stored
+	CouchbaseCollection = "locks"
+
+	cbTimeout = time.Second * 5
+)
+
+// Elector elects a single leader among the replicas sharing a lease name. The
+// lease is a document that is inserted by the leader and renewed with CAS
+// before it expires. Replicas stand by until the document expires, or is
+// released, and then race to insert it.
+type Elector struct {
+	bucket     string
+	cluster    *gocb.Cluster
+	collection *gocb.Collection
+	logger     *zap.Logger
+	key        string
+	owner      string
+	ttl        time.Duration
+
+	mu       sync.Mutex
+	cas      gocb.Cas
+	acquired time.Time
+	renewed  time.Time
+}
+
+// Config is the configuration of the elector
+type Config struct {
+	// Name is the name of the lease, replicas with the same name compete
+	Name string
+
+	// Owner uniquely identifies the replica
+	Owner string
+
+	// TTL is how long the lease lasts without being renewed, which is how
+	// long it takes a standby to take over after the leader dies. A leader
+	// failing to renew stops leading half a TTL after its last renewal.
+	TTL time.Duration
+}
+
+// lease is the lease document
+type lease struct {
+	Owner      string     `json:"owner"`
+	AcquiredAt *time.Time `json:"acquiredAt"`
+	RenewedAt  *time.Time `json:"renewedAt"`
+}
+
+func NewElector(logger *zap.Logger, cluster *gocb.Cluster, bucket string, cfg Config) (*Elector, error) {
+	e := Elector{
+		bucket:  bucket,
+		cluster: cluster,
+		logger:  logger,
+		key:     "lease::" + cfg.Name,
+		owner:   cfg.Owner,
+		ttl:     cfg.TTL,
+	}
+
+	if err := e.validate(cfg); err != nil {
+		return nil, err
+	}
+
+	bkt := e.cluster.Bucket(e.bucket)
+	if err := bkt.WaitUntilReady(cbTimeout, nil); err != nil {
+		return nil, fmt.Errorf("unable to wait for bucket to be ready: %w", err)
+	}
+	e.collection = bkt.Scope(sales.CouchbaseScope).Collection(CouchbaseCollection)
+	e.logger = e.logger.With(zap.String("lease", cfg.Name), zap.String("owner", e.owner))
+
+	return &e, nil
+}
+
+func (e *Elector) validate(cfg Config) error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return e.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return e.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return e.bucket != "" },
+		},
+		{
+			dep: "name",
+			chk: func() bool { return cfg.Name != "" },
+		},
+		{
+			dep: "owner",
+			chk: func() bool { return e.owner != "" },
+		},
+		{
+			// renewals need a few seconds of slack to complete
+			dep: "ttl",
+			chk: func() bool { return e.ttl >= 3*time.Second },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize elector due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Run competes for the lease until the context is done. While the lease is
+// held, lead is run with a context that is cancelled half a ttl after the
+// lease was last renewed, leaving lead the other half to return before the
+// lease could expire and be taken over. Lead is run again whenever the lease
+// is reacquired. The lease is released when the context is done so a standby
+// can take over immediately.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context) error) error {
+	// renew well within the ttl so a slow renewal doesn't lose the lease
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	var current *term
+	for {
+		// lead is restarted on the next tick if it stopped on its own
+		if current != nil && current.stopped() {
+			current.stop()
+			current = nil
+		}
+
+		leading := e.tryLead()
+		switch {
+		case leading && current == nil:
+			e.logger.Info("acquired leadership")
+			current = e.startTerm(ctx, lead)
+		case leading:
+			current.extend(e.untilStepDown())
+		case current != nil:
+			e.logger.Warn("lost leadership")
+			current.stop()
+			current = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if current != nil {
+				current.stop()
+			}
+			e.release()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leading returns whether the lease is held, and since when
+func (e *Elector) Leading() (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.acquired, e.cas != 0
+}
+
+// untilStepDown returns how long lead may run unless the lease is renewed
+// again. Lead is cancelled half a ttl after the last renewal.
+func (e *Elector) untilStepDown() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return time.Until(e.renewed.Add(e.ttl / 2))
+}
+
+// term is a run of lead while the lease is held
+type term struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	deadline *time.Timer
+}
+
+func (e *Elector) startTerm(ctx context.Context, lead func(ctx context.Context) error) *term {
+	ctx, cancel := context.WithCancel(ctx)
+	t := term{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		deadline: time.AfterFunc(e.untilStepDown(), cancel),
+	}
+
+	go func() {
+		defer close(t.done)
+		if err := lead(ctx); err != nil {
+			e.logger.Error("leader stopped", zap.Error(err))
+		}
+	}()
+
+	return &t
+}
+
+// extend cancels lead after d instead, as the lease was renewed
+func (t *term) extend(d time.Duration) {
+	t.deadline.Reset(d)
+}
+
+// stop cancels lead and waits for it to return
+func (t *term) stop() {
+	t.deadline.Stop()
+	t.cancel()
+	<-t.done
+}
+
+func (t *term) stopped() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// tryLead acquires, or renews, the lease and returns whether it is held
+func (e *Elector) tryLead() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now().UTC()
+	if e.cas != 0 {
+		res, err := e.collection.Replace(e.key, lease{Owner: e.owner, AcquiredAt: &e.acquired, RenewedAt: &now}, &gocb.ReplaceOptions{
+			Cas:     e.cas,
+			Expiry:  e.ttl,
+			Timeout: cbTimeout,
+		})
+		switch {
+		case err == nil:
+			e.cas, e.renewed = res.Cas(), now
+			return true
+		case errors.Is(err, gocb.ErrCasMismatch), errors.Is(err, gocb.ErrDocumentNotFound):
+			// the lease expired and was possibly taken over
+			e.cas = 0
+		default:
+			// the lease may still be held, step down before it could have
+			// expired rather than risk two leaders. Lead is cancelled by
+			// then, see untilStepDown.
+			e.logger.Warn("unable to renew lease", zap.Error(err))
+			if time.Since(e.renewed) < e.ttl/2 {
+				return true
+			}
+			e.cas = 0
+			return false
+		}
+	}
+
+	res, err := e.collection.Insert(e.key, lease{Owner: e.owner, AcquiredAt: &now, RenewedAt: &now}, &gocb.InsertOptions{
+		Expiry:  e.ttl,
+		Timeout: cbTimeout,
+	})
+	switch {
+	case err == nil:
+		e.cas, e.acquired, e.renewed = res.Cas(), now, now
+		return true
+	case errors.Is(err, gocb.ErrDocumentExists):
+		e.logger.Debug("standing by, lease is held by another replica")
+	default:
+		e.logger.Warn("unable to acquire lease", zap.Error(err))
+	}
+
+	return false
+}
+
+// release removes the lease, if still held
+func (e *Elector) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cas == 0 {
+		return
+	}
+
+	if _, err := e.collection.Remove(e.key, &gocb.RemoveOptions{Cas: e.cas, Timeout: cbTimeout}); err != nil {
+		e.logger.Warn("unable to release lease", zap.Error(err))
+		return
+	}
+	e.cas = 0
+	e.logger.Info("released leadership")
+}
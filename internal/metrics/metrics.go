@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "bromato"
+
+// SkipReason is the reason a scanned signature isn't saved as a sale
+type SkipReason string
+
+const (
+	// SkipNoTransaction is a transaction without meta data, or that failed
+	SkipNoTransaction SkipReason = "no_transaction"
+	// SkipNotMarketplace is a transaction of none of the supported marketplaces
+	SkipNotMarketplace SkipReason = "not_marketplace"
+	// SkipBelowMinPrice is a transaction too cheap to be a sale e.g. a listing
+	SkipBelowMinPrice SkipReason = "below_min_price"
+)
+
+// Run is a loop whose last successful run is tracked
+type Run string
+
+const (
+	Ingestion Run = "ingestion"
+
+	// Publishing succeeds once every channel was attempted, whether or not
+	// they published, see PublishingTo for the channels
+	Publishing Run = "publishing"
+)
+
+// PublishingTo is the run of publishing to the channel
+func PublishingTo(channel string) Run {
+	return Publishing + Run("."+channel)
+}
+
+var (
+	SignaturesScanned = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingestion",
+		Name:      "signatures_scanned_total",
+		Help:      "Signatures of the royalty address scanned for new sales.",
+	})
+
+	SalesCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingestion",
+		Name:      "sales_created_total",
+		Help:      "Sales saved, by marketplace.",
+	}, []string{"marketplace"})
+
+	SalesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingestion",
+		Name:      "signatures_skipped_total",
+		Help:      "Signatures scanned that weren't saved as sales, by reason.",
+	}, []string{"reason"})
+
+	RPCCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "calls_total",
+		Help:      "Solana RPC calls, by method.",
+	}, []string{"method"})
+
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "Solana RPC calls that failed, by method.",
+	}, []string{"method"})
+
+	RPCLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "latency_seconds",
+		Help:      "Latency of the Solana RPC calls, by method.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"method"})
+
+	PublishAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "publishing",
+		Name:      "attempts_total",
+		Help:      "Attempts to publish a sale, by channel.",
+	}, []string{"channel"})
+
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "publishing",
+		Name:      "failures_total",
+		Help:      "Attempts to publish a sale that failed, by channel.",
+	}, []string{"channel"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "publishing",
+		Name:      "queue_depth",
+		Help:      "Sales yet to be published, retries included, by channel.",
+	}, []string{"channel"})
+
+	CouchbaseLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "couchbase",
+		Name:      "latency_seconds",
+		Help:      "Latency of the Couchbase operations, by service and operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"service", "operation"})
+
+	LastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful run, by run.",
+	}, []string{"run"})
+)
+
+// ObserveRPC calls do, recording the call of the RPC method
+func ObserveRPC(method string, do func() error) error {
+	start := time.Now()
+	err := do()
+
+	RPCCalls.WithLabelValues(method).Inc()
+	RPCLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+	}
+
+	return err
+}
+
+// lastSuccess is the time of the last successful run of each run, as the
+// gauge can't be read back
+var (
+	mu          sync.Mutex
+	lastSuccess = make(map[Run]time.Time)
+)
+
+// Succeeded records the successful run at the current time
+func Succeeded(run Run) {
+	now := time.Now()
+
+	mu.Lock()
+	lastSuccess[run] = now
+	mu.Unlock()
+
+	LastSuccess.WithLabelValues(string(run)).Set(float64(now.UnixNano()) / 1e9)
+}
+
+// LastSucceeded returns the time of the last successful run, zero when it
+// hasn't succeeded since the process started
+func LastSucceeded(run Run) time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return lastSuccess[run]
+}
+
+// CouchbaseMeter records the latency of the Couchbase operations, it is set
+// as the meter of the cluster
+type CouchbaseMeter struct{}
+
+var _ gocb.Meter = CouchbaseMeter{}
+
+// operationsMetric is the name of the SDK's latency metric, the others aren't
+// recorded
+const operationsMetric = "db.couchbase.operations"
+
+// Counter returns a counter that records nothing, the SDK doesn't count
+// anything that isn't covered by the latency
+func (CouchbaseMeter) Counter(string, map[string]string) (gocb.Counter, error) {
+	return noopRecorder{}, nil
+}
+
+// ValueRecorder returns the recorder of the operation's latency
+func (CouchbaseMeter) ValueRecorder(name string, tags map[string]string) (gocb.ValueRecorder, error) {
+	if name != operationsMetric {
+		return noopRecorder{}, nil
+	}
+
+	return latencyRecorder{
+		observer: CouchbaseLatency.WithLabelValues(tags["db.couchbase.service"], tags["db.operation"]),
+	}, nil
+}
+
+// latencyRecorder records latencies given in microseconds, as the SDK does
+type latencyRecorder struct {
+	observer prometheus.Observer
+}
+
+func (r latencyRecorder) RecordValue(micros uint64) {
+	r.observer.Observe(float64(micros) / 1e6)
+}
+
+type noopRecorder struct{}
+
+func (noopRecorder) IncrementBy(uint64) {}
+
+func (noopRecorder) RecordValue(uint64) {}
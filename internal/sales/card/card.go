@@ -0,0 +1,301 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/media"
+	"bromato-sales/internal/sales/posts"
+)
+
+const (
+	// Width and Height are the dimensions of the cards, the 16:9 ratio is
+	// shown uncropped in the twitter and discord timelines
+	Width  = 1200
+	Height = 675
+
+	// margin is the space around the card's text panel
+	margin = 40
+)
+
+// Template is the design of the sale cards of a collection. The NFT image
+// fills the left of the card and the text is rendered on the right.
+type Template struct {
+	// Collection is the collection the template is for, empty for the default
+	// template
+	Collection sales.NFTCollection `json:"collection"`
+
+	// Background, Foreground and Accent are the colors of the card as hex
+	// e.g. #1A1A1A
+	Background string `json:"background"`
+	Foreground string `json:"foreground"`
+	Accent     string `json:"accent"`
+
+	// Brand is the collection branding rendered at the top of the card
+	Brand string `json:"brand"`
+
+	// Lines are the lines of text under the brand. They are post templates,
+	// see the posts package for the available data and functions.
+	Lines []string `json:"lines"`
+
+	// Footer is a post template rendered at the bottom of the card e.g. the
+	// marketplace
+	Footer string `json:"footer"`
+}
+
+// Config is the configuration of the sale cards
+type Config struct {
+	// Templates override the default template
+	Templates []Template `json:"templates"`
+}
+
+// DefaultTemplate is the card template used when no configured template
+// matches the sale's collection
+var DefaultTemplate = Template{
+	Background: "#1A1A1A",
+	Foreground: "#F5F5F5",
+	Accent:     "#E0312B",
+	Brand:      "BAD BROMATOES",
+	Lines: []string{
+		"{{ .Sale.NFT.Name }}",
+		"{{ with sol .Sale.Price }}{{ . }} SOL{{ end }}",
+		"{{ with usd .Sale.Price .SOLUSD }}{{ . }}{{ end }}",
+		"{{ with rarity .Sale.MintPubkey }}RANK {{ . }}{{ end }}",
+	},
+	Footer: "{{ with .Sale.Marketplace }}SOLD ON {{ . }}{{ end }}",
+}
+
+// Renderer renders sale cards, the NFT image composited with the sale's
+// details and the collection's branding
+type Renderer struct {
+	designs   map[sales.NFTCollection]*design
+	logger    *zap.Logger
+	templates *posts.Templates
+}
+
+// design is a parsed Template
+type design struct {
+	background color.Color
+	foreground color.Color
+	accent     color.Color
+	brand      string
+	lines      []*template.Template
+	footer     *template.Template
+}
+
+func NewRenderer(logger *zap.Logger, templates *posts.Templates, cfg Config) (*Renderer, error) {
+	r := Renderer{
+		designs:   make(map[sales.NFTCollection]*design),
+		logger:    logger,
+		templates: templates,
+	}
+
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range append([]Template{DefaultTemplate}, cfg.Templates...) {
+		d, err := r.parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid card template for collection %q: %w", t.Collection, err)
+		}
+		r.designs[t.Collection] = d
+	}
+
+	return &r, nil
+}
+
+func (r *Renderer) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return r.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return r.templates != nil },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize card renderer due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// ReadConfig reads the card configuration from a JSON file of the form
+// {"templates": [{"collection": "...", "brand": "...", "lines": ["..."]}]}
+func ReadConfig(path string) (Config, error) {
+	var cfg Config
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read cards file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to decode cards file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Render renders the sale card of the sale as a PNG
+func (r *Renderer) Render(ctx context.Context, record sales.Record, nft *media.Image) (*media.Image, error) {
+	logger := r.logger.With(zap.String("saleId", record.ID))
+
+	d, ok := r.designs[record.Collection]
+	if !ok {
+		d = r.designs[""]
+	}
+
+	src, err := media.Decode(nft)
+	if err != nil {
+		const msg = "unable to decode nft image"
+		logger.Error(msg, zap.Error(err), zap.String("contentType", nft.ContentType))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	lines := make([]string, 0, len(d.lines))
+	for _, tmpl := range d.lines {
+		line, err := r.templates.Execute(ctx, tmpl, record)
+		if err != nil {
+			const msg = "unable to render card line"
+			logger.Error(msg, zap.Error(err))
+			return nil, fmt.Errorf(msg+": %w", err)
+		}
+		// lines rendering to nothing, e.g. unknown rarity, are dropped
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var footer string
+	if d.footer != nil {
+		footer, err = r.templates.Execute(ctx, d.footer, record)
+		if err != nil {
+			const msg = "unable to render card footer"
+			logger.Error(msg, zap.Error(err))
+			return nil, fmt.Errorf(msg+": %w", err)
+		}
+	}
+
+	card := compose(d, src, lines, footer)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, card); err != nil {
+		const msg = "unable to encode card"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	return &media.Image{Data: buf.Bytes(), ContentType: "image/png"}, nil
+}
+
+func (r *Renderer) parse(t Template) (*design, error) {
+	d := design{brand: t.Brand}
+
+	var err error
+	for _, c := range []struct {
+		hex string
+		dst *color.Color
+		def color.Color
+	}{
+		{hex: t.Background, dst: &d.background, def: color.Black},
+		{hex: t.Foreground, dst: &d.foreground, def: color.White},
+		{hex: t.Accent, dst: &d.accent, def: color.White},
+	} {
+		if c.hex == "" {
+			*c.dst = c.def
+			continue
+		}
+		if *c.dst, err = parseHex(c.hex); err != nil {
+			return nil, err
+		}
+	}
+
+	name := "card/" + string(t.Collection)
+	for i, line := range t.Lines {
+		tmpl, err := r.templates.Parse(name+"/line"+strconv.Itoa(i), line)
+		if err != nil {
+			return nil, err
+		}
+		d.lines = append(d.lines, tmpl)
+	}
+
+	if t.Footer != "" {
+		if d.footer, err = r.templates.Parse(name+"/footer", t.Footer); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// compose draws the card. The NFT image is scaled to the card's height,
+// nearest neighbour scaling keeps pixel art crisp when upscaling.
+func compose(d *design, nft image.Image, lines []string, footer string) image.Image {
+	card := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(card, card.Bounds(), image.NewUniform(d.background), image.Point{}, draw.Src)
+
+	nftRect := image.Rect(0, 0, Height, Height)
+	scaler := draw.Interpolator(draw.CatmullRom)
+	if b := nft.Bounds(); b.Dx() < Height && b.Dy() < Height {
+		scaler = draw.NearestNeighbor
+	}
+	scaler.Scale(card, nftRect, nft, nft.Bounds(), draw.Over, nil)
+
+	// accent stripe between the image and the text panel
+	draw.Draw(card, image.Rect(Height, 0, Height+8, Height), image.NewUniform(d.accent), image.Point{}, draw.Src)
+
+	panel := image.Rect(Height+8+margin, margin, Width-margin, Height-margin)
+	y := panel.Min.Y
+	if d.brand != "" {
+		y = drawText(card, panel, y, d.brand, d.accent, 4) + 24
+	}
+	for _, line := range lines {
+		y = drawText(card, panel, y, line, d.foreground, 3) + 12
+	}
+
+	if footer != "" {
+		drawText(card, panel, panel.Max.Y-lineHeight*2, footer, d.accent, 2)
+	}
+
+	return card
+}
+
+func parseHex(hex string) (color.Color, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return nil, fmt.Errorf("invalid color: %s", hex)
+	}
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
@@ -0,0 +1,46 @@
+package card
+
+import (
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// lineHeight is the height of a line of unscaled text
+const lineHeight = 13
+
+// face is the bitmap font of the cards. The fixed width pixel font is scaled
+// up by whole multiples to match the pixel art of the collections.
+var face = basicfont.Face7x13
+
+// drawText draws a line of text at y within the panel, truncating text wider
+// than the panel, and returns the y of the bottom of the line
+func drawText(dst draw.Image, panel image.Rectangle, y int, text string, c color.Color, scale int) int {
+	maxChars := panel.Dx() / (face.Advance * scale)
+	if runes := []rune(text); len(runes) > maxChars {
+		text = string(runes[:maxChars-3]) + "..."
+	}
+
+	// draw the text at its native size, then scale it on to the card
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return y
+	}
+	line := image.NewRGBA(image.Rect(0, 0, width, lineHeight))
+	d := font.Drawer{
+		Dst:  line,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	d.DrawString(text)
+
+	target := image.Rect(panel.Min.X, y, panel.Min.X+width*scale, y+lineHeight*scale)
+	draw.NearestNeighbor.Scale(dst, target, line, line.Bounds(), draw.Over, nil)
+
+	return target.Max.Y
+}
@@ -6,4 +6,7 @@ func (e Error) Error() string { return string(e) }
 
 const (
 	ErrNotFound Error = "sale record(s) not found"
+
+	// ErrConflict is returned when a record was modified concurrently
+	ErrConflict Error = "sale record modified concurrently"
 )
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+// Event is an event emitted on the bus
+type Event interface {
+	// Name returns the name of the event e.g. sale.detected
+	Name() string
+}
+
+// SaleDetected is emitted once a new sale has been saved
+type SaleDetected struct {
+	Sale       sales.Record
+	DetectedAt time.Time
+}
+
+// Name returns the name of the event
+func (SaleDetected) Name() string { return "sale.detected" }
+
+// SalePublished is emitted once a sale has been published to a channel
+type SalePublished struct {
+	Sale        sales.Record
+	Channel     sales.PublishChannel
+	ExternalID  string
+	PublishedAt time.Time
+}
+
+// Name returns the name of the event
+func (SalePublished) Name() string { return "sale.published" }
+
+// Bus fans events out to its subscribers in process. Delivery is best effort,
+// events are dropped for subscribers that fall behind rather than blocking
+// the emitter. The database remains the source of truth, subscribers that
+// need every event must also recover from it e.g. by polling on an interval.
+type Bus struct {
+	logger *zap.Logger
+
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription is a subscriber's view of the bus
+type Subscription struct {
+	bus    *Bus
+	events chan Event
+	name   string
+	once   sync.Once
+}
+
+func NewBus(logger *zap.Logger) (*Bus, error) {
+	b := Bus{
+		logger: logger,
+		subs:   make(map[*Subscription]struct{}),
+	}
+
+	if b.logger == nil {
+		return nil, fmt.Errorf("unable to initialize event bus due to (1) missing dependencies: logger")
+	}
+
+	return &b, nil
+}
+
+// Subscribe subscribes to every event emitted on the bus. Buffer is the number
+// of events held for the subscriber before events are dropped.
+func (b *Bus) Subscribe(name string, buffer int) *Subscription {
+	s := Subscription{
+		bus:    b,
+		events: make(chan Event, buffer),
+		name:   name,
+	}
+
+	b.mu.Lock()
+	b.subs[&s] = struct{}{}
+	b.mu.Unlock()
+
+	return &s
+}
+
+// Emit emits the event to every subscriber without blocking
+func (b *Bus) Emit(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		select {
+		case s.events <- e:
+		default:
+			b.logger.Warn(
+				"dropping event for slow subscriber",
+				zap.String("event", e.Name()),
+				zap.String("subscriber", s.name),
+			)
+		}
+	}
+}
+
+// Events returns the channel the subscription's events are delivered on. The
+// channel is closed when the subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes from the bus
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+
+		close(s.events)
+	})
+}
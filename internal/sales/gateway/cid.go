@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// codecRaw is the multicodec of content stored as is, only raw content
+	// can be verified by hashing the fetched bytes. UnixFS (dag-pb) content,
+	// including every CIDv0, hashes the chunked DAG rather than the file.
+	codecRaw = 0x55
+
+	// hashSHA256 is the multihash code of sha2-256
+	hashSHA256 = 0x12
+)
+
+// base32Lower is the multibase "b" encoding used by CIDv1
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// verify verifies the content against its content identifier, when possible.
+// Content that cannot be verified is accepted.
+func (r *reference) verify(data []byte) error {
+	if r.scheme != ipfs || r.path != "" && !strings.HasPrefix(r.path, "?") {
+		return nil
+	}
+
+	digest, ok := rawSHA256Digest(r.id)
+	if !ok {
+		return nil
+	}
+
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], digest) {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, r.id)
+	}
+
+	return nil
+}
+
+// rawSHA256Digest returns the sha2-256 digest of a base32 CIDv1 of raw
+// content. False is returned for any other CID.
+func rawSHA256Digest(cid string) ([]byte, bool) {
+	if !strings.HasPrefix(cid, "b") {
+		return nil, false
+	}
+
+	b, err := base32Lower.DecodeString(strings.ToLower(cid[1:]))
+	if err != nil {
+		return nil, false
+	}
+
+	var fields [4]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, false
+		}
+		fields[i], b = v, b[n:]
+	}
+
+	version, codec, hashCode, length := fields[0], fields[1], fields[2], fields[3]
+	if version != 1 || codec != codecRaw || hashCode != hashSHA256 || length != sha256.Size || len(b) != sha256.Size {
+		return nil, false
+	}
+
+	return b, true
+}
@@ -0,0 +1,293 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout is the default time given to a gateway before falling back
+// to the next one
+const DefaultTimeout = 20 * time.Second
+
+var (
+	// DefaultIPFSGateways are the default IPFS gateways, in order of preference
+	DefaultIPFSGateways = []string{"https://cloudflare-ipfs.com", "https://ipfs.io", "https://gateway.pinata.cloud"}
+
+	// DefaultArweaveGateways are the default Arweave gateways, in order of
+	// preference
+	DefaultArweaveGateways = []string{"https://arweave.net"}
+)
+
+var (
+	// ErrTooLarge is returned when the content exceeds the size limit
+	ErrTooLarge = errors.New("content too large")
+
+	// ErrHashMismatch is returned when the content does not match the hash
+	// of its content identifier
+	ErrHashMismatch = errors.New("content hash mismatch")
+)
+
+// Resolver fetches the content of NFT metadata and media URIs. IPFS and
+// Arweave URIs, including http URIs of a single gateway, are rewritten to the
+// configured gateways which are tried in order until one succeeds.
+type Resolver struct {
+	arweaveGateways []string
+	client          *http.Client
+	ipfsGateways    []string
+	logger          *zap.Logger
+	timeout         time.Duration
+}
+
+// Config is the configuration of the resolver, zero values use the defaults
+type Config struct {
+	// IPFSGateways are the base URLs of the IPFS gateways e.g. https://ipfs.io
+	IPFSGateways []string
+
+	// ArweaveGateways are the base URLs of the Arweave gateways
+	ArweaveGateways []string
+
+	// Timeout is the time given to each gateway
+	Timeout time.Duration
+}
+
+func NewResolver(logger *zap.Logger, cfg Config) (*Resolver, error) {
+	r := Resolver{
+		arweaveGateways: trimGateways(cfg.ArweaveGateways),
+		client:          new(http.Client),
+		ipfsGateways:    trimGateways(cfg.IPFSGateways),
+		logger:          logger,
+		timeout:         cfg.Timeout,
+	}
+	if len(r.ipfsGateways) == 0 {
+		r.ipfsGateways = DefaultIPFSGateways
+	}
+	if len(r.arweaveGateways) == 0 {
+		r.arweaveGateways = DefaultArweaveGateways
+	}
+	if r.timeout <= 0 {
+		r.timeout = DefaultTimeout
+	}
+
+	if r.logger == nil {
+		return nil, fmt.Errorf("unable to initialize resolver due to (1) missing dependencies: logger")
+	}
+
+	return &r, nil
+}
+
+// Fetch returns the content of the URI, failing when it exceeds maxBytes. Each
+// gateway is tried in turn, content whose hash can be derived from its URI is
+// verified and the next gateway is tried on a mismatch.
+func (r *Resolver) Fetch(ctx context.Context, uri string, maxBytes int64) ([]byte, error) {
+	logger := r.logger.With(zap.String("uri", uri))
+
+	ref, err := parse(uri)
+	if err != nil {
+		const msg = "unable to parse uri"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	var errs error
+	for _, u := range r.urls(ref) {
+		data, err := r.fetch(ctx, u, maxBytes)
+		if err == nil {
+			err = ref.verify(data)
+		}
+		if err == nil {
+			return data, nil
+		}
+
+		logger.Warn("unable to fetch from gateway", zap.String("url", u), zap.Error(err))
+		errs = multierr.Append(errs, err)
+
+		// the content is the same on every gateway
+		if errors.Is(err, ErrTooLarge) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("unable to fetch %s: %w", uri, errs)
+}
+
+// URLs returns the http URLs the URI is fetched from, in order
+func (r *Resolver) URLs(uri string) ([]string, error) {
+	ref, err := parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.urls(ref), nil
+}
+
+func (r *Resolver) urls(ref *reference) []string {
+	var gateways []string
+	switch ref.scheme {
+	case ipfs:
+		gateways = r.ipfsGateways
+	case arweave:
+		gateways = r.arweaveGateways
+	default:
+		return []string{ref.url}
+	}
+
+	urls := make([]string, 0, len(gateways))
+	for _, g := range gateways {
+		urls = append(urls, g+ref.gatewayPath())
+	}
+
+	return urls
+}
+
+func (r *Resolver) fetch(ctx context.Context, u string, maxBytes int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("received non-200 response: %d", resp.StatusCode)
+	}
+
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrTooLarge, maxBytes)
+	}
+
+	return data, nil
+}
+
+func trimGateways(gateways []string) []string {
+	trimmed := make([]string, 0, len(gateways))
+	for _, g := range gateways {
+		if g = strings.TrimSuffix(strings.TrimSpace(g), "/"); g != "" {
+			trimmed = append(trimmed, g)
+		}
+	}
+
+	return trimmed
+}
+
+// scheme is the storage network of a URI
+type scheme int
+
+const (
+	web scheme = iota
+	ipfs
+	arweave
+)
+
+// reference is a parsed URI
+type reference struct {
+	scheme scheme
+
+	// url is the URI of web references
+	url string
+
+	// id is the CID, or Arweave transaction ID, and path the path within it
+	id   string
+	path string
+}
+
+// parse parses the URI. Besides ipfs:// and ar:// URIs, the http URIs of IPFS
+// path and subdomain gateways and of arweave.net are recognised so that they
+// fall back to the configured gateways.
+func parse(uri string) (*reference, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ipfs":
+		// ipfs://<cid>/path, some mints use ipfs://ipfs/<cid>/path
+		p := strings.TrimPrefix(u.Host+u.Path, "ipfs/")
+		return splitID(ipfs, p, u.RawQuery)
+	case "ar":
+		return splitID(arweave, u.Host+u.Path, u.RawQuery)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported uri scheme: %q", u.Scheme)
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, "/ipfs/"):
+		return splitID(ipfs, strings.TrimPrefix(u.Path, "/ipfs/"), u.RawQuery)
+	case strings.Contains(u.Host, ".ipfs."):
+		cid := u.Host[:strings.Index(u.Host, ".ipfs.")]
+		return splitID(ipfs, cid+u.Path, u.RawQuery)
+	case u.Host == "arweave.net" || strings.HasSuffix(u.Host, ".arweave.net"):
+		if id := strings.TrimPrefix(u.Path, "/"); isArweaveID(strings.SplitN(id, "/", 2)[0]) {
+			return splitID(arweave, id, u.RawQuery)
+		}
+	}
+
+	return &reference{scheme: web, url: u.String()}, nil
+}
+
+func splitID(s scheme, p string, rawQuery string) (*reference, error) {
+	parts := strings.SplitN(strings.Trim(p, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.New("missing content identifier")
+	}
+
+	ref := reference{scheme: s, id: parts[0]}
+	if len(parts) > 1 {
+		ref.path = "/" + parts[1]
+	}
+	// query strings such as ?ext=png are kept for the gateways that use them
+	if rawQuery != "" {
+		ref.path += "?" + rawQuery
+	}
+
+	return &ref, nil
+}
+
+func (r *reference) gatewayPath() string {
+	if r.scheme == ipfs {
+		return "/ipfs/" + r.id + r.path
+	}
+
+	return "/" + r.id + r.path
+}
+
+// isArweaveID returns whether s is an Arweave transaction ID, 43 characters of
+// base64url
+func isArweaveID(s string) bool {
+	if len(s) != 43 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
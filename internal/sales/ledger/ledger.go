@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	cbTimeout = time.Second * 5
+
+	// entryExpiry is how long entries are kept, they only need to outlive
+	// the time in which a post could be attempted again
+	entryExpiry = 30 * 24 * time.Hour
+)
+
+// ErrAlreadyPosted is returned when claiming a post that was posted, or is
+// being posted
+var ErrAlreadyPosted = errors.New("already posted")
+
+// Status is the status of a post
+type Status string
+
+const (
+	Posting Status = "posting"
+	Posted  Status = "posted"
+)
+
+// Ledger records the posts other than sales, e.g. recaps, so that each is
+// posted at most once whichever replica posts it. A post is claimed before it
+// is sent and completed afterwards. Only the claim of a post known not to have
+// been made is released, a post interrupted while being sent keeps its claim
+// and is never retried as it may have been posted.
+type Ledger struct {
+	bucket     string
+	cluster    *gocb.Cluster
+	collection *gocb.Collection
+	logger     *zap.Logger
+	owner      string
+}
+
+// Entry is the record of a post to a channel
+type Entry struct {
+	// Key uniquely identifies the post on the channel
+	Key string `json:"-"`
+
+	Channel    sales.PublishChannel `json:"channel"`
+	Status     Status               `json:"status"`
+	Owner      string               `json:"owner"`
+	ExternalID string               `json:"externalId"`
+	ClaimedAt  *time.Time           `json:"claimedAt"`
+	PostedAt   *time.Time           `json:"postedAt"`
+
+	// Details describes the post e.g. the period of a recap
+	Details interface{} `json:"details"`
+
+	cas gocb.Cas
+}
+
+// New returns the ledger stored in the collection, of the sales scope. Owner
+// uniquely identifies the instance.
+func New(logger *zap.Logger, cluster *gocb.Cluster, bucket string, collection string, owner string) (*Ledger, error) {
+	l := Ledger{
+		bucket:  bucket,
+		cluster: cluster,
+		logger:  logger,
+		owner:   owner,
+	}
+
+	if err := l.validate(collection); err != nil {
+		return nil, err
+	}
+
+	bkt := l.cluster.Bucket(l.bucket)
+	if err := bkt.WaitUntilReady(cbTimeout, nil); err != nil {
+		return nil, fmt.Errorf("unable to wait for bucket to be ready: %w", err)
+	}
+	l.collection = bkt.Scope(sales.CouchbaseScope).Collection(collection)
+
+	return &l, nil
+}
+
+func (l *Ledger) validate(collection string) error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return l.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return l.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return l.bucket != "" },
+		},
+		{
+			dep: "collection",
+			chk: func() bool { return collection != "" },
+		},
+		{
+			dep: "owner",
+			chk: func() bool { return l.owner != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize ledger due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Claim records the post as being posted by this instance. ErrAlreadyPosted
+// is returned when the post was already claimed.
+func (l *Ledger) Claim(e *Entry) error {
+	now := time.Now().UTC()
+	e.Status = Posting
+	e.Owner = l.owner
+	e.ClaimedAt = &now
+
+	res, err := l.collection.Insert(e.Key, e, &gocb.InsertOptions{
+		Expiry:  entryExpiry,
+		Timeout: cbTimeout,
+	})
+	if err != nil {
+		if errors.Is(err, gocb.ErrDocumentExists) {
+			return ErrAlreadyPosted
+		}
+		return err
+	}
+	e.cas = res.Cas()
+
+	return nil
+}
+
+// Release removes the claim of a post known not to have been made, e.g. its
+// error matches publisher.ErrNotPosted, so that it can be retried
+func (l *Ledger) Release(e *Entry) {
+	if _, err := l.collection.Remove(e.Key, &gocb.RemoveOptions{Cas: e.cas, Timeout: cbTimeout}); err != nil {
+		l.logger.Warn("unable to release claim", zap.Error(err), zap.String("key", e.Key))
+	}
+}
+
+// Complete records the claimed post as posted
+func (l *Ledger) Complete(e *Entry, externalID string) error {
+	now := time.Now().UTC()
+	e.Status = Posted
+	e.ExternalID = externalID
+	e.PostedAt = &now
+
+	res, err := l.collection.Replace(e.Key, e, &gocb.ReplaceOptions{
+		Cas:     e.cas,
+		Expiry:  entryExpiry,
+		Timeout: cbTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	e.cas = res.Cas()
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the gif decoder
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the webp decoder
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/gateway"
+)
+
+// ErrTooLarge is returned when media exceeds a size limit, including the
+// download limits enforced by the gateway resolver
+var ErrTooLarge = gateway.ErrTooLarge
+
+// Limits are the limits a channel places on uploaded images
+type Limits struct {
+	// MaxBytes is the maximum size of the image, 0 for no limit
+	MaxBytes int
+
+	// MaxDimension is the maximum width and height of the image, 0 for no
+	// limit
+	MaxDimension int
+
+	// Formats are the accepted content types, any format is accepted when
+	// empty. Other formats are converted to PNG, or JPEG when the PNG is too
+	// large.
+	Formats []string
+}
+
+// DefaultLimits are the image limits of the channels that upload media
+var DefaultLimits = map[sales.PublishChannel]Limits{
+	sales.Twitter: {
+		MaxBytes:     5 * 1024 * 1024,
+		MaxDimension: 4096,
+		Formats:      []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+	},
+	sales.Discord: {
+		MaxBytes: 8 * 1024 * 1024,
+	},
+	sales.Telegram: {
+		MaxBytes:     10 * 1024 * 1024,
+		MaxDimension: 5000,
+		Formats:      []string{"image/png", "image/jpeg", "image/gif"},
+	},
+	sales.Mastodon: {
+		MaxBytes:     8 * 1024 * 1024,
+		MaxDimension: 4096,
+		Formats:      []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+	},
+}
+
+// MaxPixels guards against decoding images that would exhaust memory, small
+// files can declare huge dimensions
+const MaxPixels = 64 * 1024 * 1024
+
+// minDimension is the smallest an image is downsized to before giving up
+const minDimension = 64
+
+// jpegQualities are the qualities tried, in order, when a JPEG is too large
+var jpegQualities = []int{90, 80, 70, 60}
+
+// Fit returns the image within the limits. Images already within the limits
+// are returned as is, otherwise they are decoded, downsized and re-encoded.
+// Animated GIFs that need processing lose their animation. Images aren't
+// decoded at all without limits, so that channels only linking the image
+// accept any format e.g. SVG.
+func Fit(img *Image, l Limits) (*Image, error) {
+	if l.none() {
+		return img, nil
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image config: %w", err)
+	}
+
+	if l.fits(img, cfg) {
+		return img, nil
+	}
+
+	if err := checkPixels(cfg); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s image: %w", format, err)
+	}
+
+	// keep shrinking until the encoded image is small enough, there is no
+	// way to know the encoded size up front
+	dim := l.MaxDimension
+	if longest := max(cfg.Width, cfg.Height); dim == 0 || dim > longest {
+		dim = longest
+	}
+	for {
+		out, err := encode(resize(src, dim), l)
+		if err != nil {
+			return nil, err
+		}
+		if out != nil {
+			return out, nil
+		}
+		if dim <= minDimension {
+			break
+		}
+		dim = dim * 3 / 4
+	}
+
+	return nil, fmt.Errorf("%w: unable to fit image in %d bytes", ErrTooLarge, l.MaxBytes)
+}
+
+// Decode decodes the image, unless it has more than MaxPixels pixels
+func Decode(img *Image) (image.Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image config: %w", err)
+	}
+
+	if err := checkPixels(cfg); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s image: %w", format, err)
+	}
+
+	return src, nil
+}
+
+func checkPixels(cfg image.Config) error {
+	if cfg.Width*cfg.Height > MaxPixels {
+		return fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	return nil
+}
+
+func (l Limits) none() bool {
+	return l.MaxBytes == 0 && l.MaxDimension == 0 && len(l.Formats) == 0
+}
+
+func (l Limits) fits(img *Image, cfg image.Config) bool {
+	if l.MaxBytes > 0 && len(img.Data) > l.MaxBytes {
+		return false
+	}
+	if l.MaxDimension > 0 && (cfg.Width > l.MaxDimension || cfg.Height > l.MaxDimension) {
+		return false
+	}
+
+	return l.accepts(img.ContentType)
+}
+
+func (l Limits) accepts(contentType string) bool {
+	if len(l.Formats) == 0 {
+		return true
+	}
+	for _, f := range l.Formats {
+		if f == contentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode encodes the image as PNG, which suits pixel art collections, falling
+// back to JPEG at decreasing quality. Nil is returned when no encoding fits.
+func encode(img image.Image, l Limits) (*Image, error) {
+	buf := new(bytes.Buffer)
+	if l.accepts("image/png") {
+		if err := png.Encode(buf, img); err != nil {
+			return nil, fmt.Errorf("unable to encode png: %w", err)
+		}
+		if l.MaxBytes == 0 || buf.Len() <= l.MaxBytes {
+			return &Image{Data: buf.Bytes(), ContentType: "image/png"}, nil
+		}
+	}
+
+	if !l.accepts("image/jpeg") {
+		return nil, nil
+	}
+	for _, q := range jpegQualities {
+		buf.Reset()
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: q}); err != nil {
+			return nil, fmt.Errorf("unable to encode jpeg: %w", err)
+		}
+		if l.MaxBytes == 0 || buf.Len() <= l.MaxBytes {
+			return &Image{Data: buf.Bytes(), ContentType: "image/jpeg"}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// resize downsizes the image so its longest side is at most dim
+func resize(src image.Image, dim int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= dim && h <= dim {
+		return src
+	}
+
+	if w >= h {
+		w, h = dim, max(1, h*dim/w)
+	} else {
+		w, h = max(1, w*dim/h), dim
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+	return dst
+}
+
+func max(i, j int) int {
+	if i > j {
+		return i
+	}
+
+	return j
+}
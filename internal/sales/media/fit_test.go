@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testImage returns a w by h image of random pixels, which compresses poorly
+func testImage(w, h int) image.Image {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = byte(r.Intn(256))
+	}
+
+	return img
+}
+
+func testPNG(t *testing.T, w, h int) *Image {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, png.Encode(buf, testImage(w, h)))
+
+	return &Image{Data: buf.Bytes(), ContentType: "image/png"}
+}
+
+func testGIF(t *testing.T, w, h int) *Image {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	buf := new(bytes.Buffer)
+	require.NoError(t, gif.Encode(buf, img, nil))
+
+	return &Image{Data: buf.Bytes(), ContentType: "image/gif"}
+}
+
+func TestFit(t *testing.T) {
+	// hugeGIF declares 65535x65535 pixels in its header
+	hugeGIF := &Image{
+		Data:        []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00"),
+		ContentType: "image/gif",
+	}
+	svg := &Image{Data: []byte("<svg/>"), ContentType: "image/svg+xml"}
+
+	for _, tc := range []struct {
+		name        string
+		img         *Image
+		limits      Limits
+		unchanged   bool
+		contentType string
+		// dimension is the expected longest side of the fitted image
+		dimension int
+		fails     bool
+		err       error
+	}{
+		{
+			name:      "no limits",
+			img:       svg,
+			limits:    Limits{},
+			unchanged: true,
+		},
+		{
+			name:      "within limits",
+			img:       testPNG(t, 100, 50),
+			limits:    Limits{MaxBytes: 1 << 20, MaxDimension: 100, Formats: []string{"image/png"}},
+			unchanged: true,
+		},
+		{
+			name:        "resized",
+			img:         testPNG(t, 200, 100),
+			limits:      Limits{MaxDimension: 50},
+			contentType: "image/png",
+			dimension:   50,
+		},
+		{
+			name:        "converted",
+			img:         testGIF(t, 40, 80),
+			limits:      Limits{Formats: []string{"image/png", "image/jpeg"}},
+			contentType: "image/png",
+			dimension:   80,
+		},
+		{
+			// the png of random pixels is larger than the jpeg
+			name:        "encoded as jpeg",
+			img:         testPNG(t, 100, 100),
+			limits:      Limits{MaxBytes: 20 * 1024, Formats: []string{"image/png", "image/jpeg"}},
+			contentType: "image/jpeg",
+			dimension:   100,
+		},
+		{
+			name:   "too large",
+			img:    testPNG(t, 100, 100),
+			limits: Limits{MaxBytes: 100, Formats: []string{"image/png"}},
+			fails:  true,
+			err:    ErrTooLarge,
+		},
+		{
+			name:   "too many pixels",
+			img:    hugeGIF,
+			limits: Limits{MaxDimension: 4096},
+			fails:  true,
+			err:    ErrTooLarge,
+		},
+		{
+			name:   "undecodable",
+			img:    svg,
+			limits: Limits{Formats: []string{"image/png"}},
+			fails:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Fit(tc.img, tc.limits)
+			if tc.fails {
+				require.Error(t, err)
+				if tc.err != nil {
+					require.True(t, errors.Is(err, tc.err))
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.unchanged {
+				require.Same(t, tc.img, out)
+				return
+			}
+
+			require.Equal(t, tc.contentType, out.ContentType)
+			if tc.limits.MaxBytes > 0 {
+				require.LessOrEqual(t, len(out.Data), tc.limits.MaxBytes)
+			}
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(out.Data))
+			require.NoError(t, err)
+			require.Equal(t, "image/"+format, out.ContentType)
+			require.Equal(t, tc.dimension, max(cfg.Width, cfg.Height))
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package media
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/gateway"
+)
+
+const (
+	// DefaultMaxDownloadBytes is the default limit of downloaded images
+	DefaultMaxDownloadBytes = 20 * 1024 * 1024
+
+	// DefaultMaxAnimationBytes is the default limit of downloaded animations,
+	// which are not re-encoded so anything larger could not be uploaded anyway
+	DefaultMaxAnimationBytes = 15 * 1024 * 1024
+
+	// DefaultCacheBytes is the default size of the cached images
+	DefaultCacheBytes = 128 * 1024 * 1024
+)
+
+// Image is a downloaded, or processed, image
+type Image struct {
+	Data []byte
+
+	// ContentType is the MIME type of the image e.g. image/png
+	ContentType string
+}
+
+// Processor downloads NFT media and prepares it for the publish channels.
+// Images are downsized and re-encoded to fit the channel's limits and the
+// processed variants are cached per mint, so a sale published to several
+// channels, or retried, does not download and process its image again.
+type Processor struct {
+	limits            map[sales.PublishChannel]Limits
+	logger            *zap.Logger
+	maxAnimationBytes int64
+	maxDownloadBytes  int64
+	resolver          *gateway.Resolver
+
+	mu          sync.Mutex
+	cache       map[string]*list.Element
+	cacheBytes  int64
+	cachedBytes int64
+	lru         *list.List
+}
+
+// Config is the configuration of the media processor, zero values use the
+// defaults
+type Config struct {
+	// MaxDownloadBytes is the size limit of downloaded images
+	MaxDownloadBytes int64
+
+	// MaxAnimationBytes is the size limit of downloaded animations
+	MaxAnimationBytes int64
+
+	// CacheBytes is the size of the images to cache, originals, animations
+	// and processed variants alike
+	CacheBytes int64
+
+	// Limits overrides the default limits of the channels
+	Limits map[sales.PublishChannel]Limits
+}
+
+type cacheEntry struct {
+	key   string
+	image *Image
+}
+
+func NewProcessor(logger *zap.Logger, resolver *gateway.Resolver, cfg Config) (*Processor, error) {
+	p := Processor{
+		limits:            make(map[sales.PublishChannel]Limits),
+		logger:            logger,
+		maxAnimationBytes: cfg.MaxAnimationBytes,
+		maxDownloadBytes:  cfg.MaxDownloadBytes,
+		resolver:          resolver,
+		cache:             make(map[string]*list.Element),
+		cacheBytes:        cfg.CacheBytes,
+		lru:               list.New(),
+	}
+	if p.maxDownloadBytes <= 0 {
+		p.maxDownloadBytes = DefaultMaxDownloadBytes
+	}
+	if p.maxAnimationBytes <= 0 {
+		p.maxAnimationBytes = DefaultMaxAnimationBytes
+	}
+	if p.cacheBytes <= 0 {
+		p.cacheBytes = DefaultCacheBytes
+	}
+	for channel, l := range DefaultLimits {
+		p.limits[channel] = l
+	}
+	for channel, l := range cfg.Limits {
+		p.limits[channel] = l
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (p *Processor) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return p.logger != nil },
+		},
+		{
+			dep: "resolver",
+			chk: func() bool { return p.resolver != nil },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize media processor due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Original returns the mint's image as downloaded from the URI
+func (p *Processor) Original(ctx context.Context, mint string, uri string) (*Image, error) {
+	if img := p.cached(mint); img != nil {
+		return img, nil
+	}
+
+	data, err := p.resolver.Fetch(ctx, uri, p.maxDownloadBytes)
+	if err != nil {
+		const msg = "unable to download image"
+		p.logger.Error(msg, zap.Error(err), zap.String("mint", mint))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+	img := &Image{Data: data, ContentType: sniff(data)}
+	p.store(mint, img)
+
+	return img, nil
+}
+
+// Variant returns the image processed to fit the channel's limits. Variants
+// are cached by the key and channel, the key identifies the image e.g. its
+// mint.
+func (p *Processor) Variant(key string, original *Image, channel sales.PublishChannel) (*Image, error) {
+	logger := p.logger.With(zap.String("key", key), zap.String("channel", string(channel)))
+
+	variantKey := key + "/" + string(channel)
+	if img := p.cached(variantKey); img != nil {
+		logger.Debug("using cached image")
+		return img, nil
+	}
+
+	img, err := Fit(original, p.limits[channel])
+	if err != nil {
+		const msg = "unable to process image"
+		logger.Error(msg, zap.Error(err), zap.String("contentType", original.ContentType))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+	if len(img.Data) != len(original.Data) {
+		logger.Debug(
+			"processed image",
+			zap.Int("originalBytes", len(original.Data)),
+			zap.Int("bytes", len(img.Data)),
+			zap.String("contentType", img.ContentType),
+		)
+	}
+	p.store(variantKey, img)
+
+	return img, nil
+}
+
+// Animation returns the mint's animation, downloaded from the URI. Animations
+// are not processed, they are only limited in size.
+func (p *Processor) Animation(ctx context.Context, mint string, uri string) (*Image, error) {
+	key := mint + "/animation"
+	if img := p.cached(key); img != nil {
+		return img, nil
+	}
+
+	data, err := p.resolver.Fetch(ctx, uri, p.maxAnimationBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download animation: %w", err)
+	}
+	img := &Image{Data: data, ContentType: sniff(data)}
+	p.store(key, img)
+
+	return img, nil
+}
+
+func (p *Processor) cached(key string) *Image {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.cache[key]
+	if !ok {
+		return nil
+	}
+	p.lru.MoveToFront(e)
+
+	return e.Value.(*cacheEntry).image
+}
+
+// store caches the image, evicting the least recently used images until the
+// cache is within its size. Images larger than the cache aren't cached.
+func (p *Processor) store(key string, img *Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.cache[key]; ok {
+		p.evict(e)
+	}
+
+	size := int64(len(img.Data))
+	if size > p.cacheBytes {
+		return
+	}
+
+	p.cache[key] = p.lru.PushFront(&cacheEntry{key: key, image: img})
+	p.cachedBytes += size
+	for p.cachedBytes > p.cacheBytes {
+		p.evict(p.lru.Back())
+	}
+}
+
+func (p *Processor) evict(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	p.lru.Remove(e)
+	delete(p.cache, entry.key)
+	p.cachedBytes -= int64(len(entry.image.Data))
+}
+
+func sniff(data []byte) string {
+	ct := http.DetectContentType(data)
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
+	}
+
+	return ct
+}
@@ -0,0 +1,371 @@
+package milestone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/ledger"
+	"bromato-sales/internal/sales/posts"
+	"bromato-sales/internal/sales/publisher"
+	"bromato-sales/internal/sales/reader"
+)
+
+const (
+	// CouchbaseCollection is the Couchbase collection, in the sales scope, in
+	// which the announced milestones are recorded
+	CouchbaseCollection = "milestones"
+
+	// maxAge is the age of a sale past which its milestones aren't announced,
+	// so that backfilled sales don't announce stale milestones
+	maxAge = 24 * time.Hour
+
+	week = 7 * 24 * time.Hour
+)
+
+// MediaSource provides the image of the NFT sold
+type MediaSource interface {
+	NFTMedia(ctx context.Context, record sales.Record, channel sales.PublishChannel) (*publisher.Media, error)
+}
+
+// Config is the configuration of the milestones
+type Config struct {
+	// WeeklyTopN announces sales ranking among the top N sales of the past
+	// week, zero disables
+	WeeklyTopN int
+
+	// SaleCountStep announces every multiple of SaleCountStep sales of a
+	// collection e.g. the 100th, 200th, zero disables
+	SaleCountStep int
+
+	// VolumeStep announces every multiple of VolumeStep, in lamports, reached
+	// by the volume of a collection, zero disables
+	VolumeStep uint64
+
+	// Owner uniquely identifies the instance announcing the milestones
+	Owner string
+}
+
+// Announcer announces the milestones reached by new sales to every poster.
+// Each announcement is recorded before it is posted so that it is never
+// posted twice, whichever replica posts it. Announcements are best effort, a
+// failed announcement is not retried.
+type Announcer struct {
+	bucket    string
+	cfg       Config
+	cluster   *gocb.Cluster
+	ledger    *ledger.Ledger
+	logger    *zap.Logger
+	media     MediaSource
+	posters   []publisher.Poster
+	reader    *reader.Service
+	templates *posts.Templates
+}
+
+// details describes a milestone in its ledger entries
+type details struct {
+	Kind       posts.MilestoneKind `json:"kind"`
+	Collection sales.NFTCollection `json:"collection"`
+	SaleID     string              `json:"saleId"`
+}
+
+func NewAnnouncer(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	bucket string,
+	r *reader.Service,
+	templates *posts.Templates,
+	media MediaSource,
+	cfg Config,
+	posters ...publisher.Poster) (*Announcer, error) {
+	a := Announcer{
+		bucket:    bucket,
+		cfg:       cfg,
+		cluster:   cluster,
+		logger:    logger,
+		media:     media,
+		posters:   posters,
+		reader:    r,
+		templates: templates,
+	}
+
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+
+	l, err := ledger.New(a.logger, a.cluster, a.bucket, CouchbaseCollection, a.cfg.Owner)
+	if err != nil {
+		return nil, err
+	}
+	a.ledger = l
+
+	return &a, nil
+}
+
+func (a *Announcer) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return a.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return a.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return a.bucket != "" },
+		},
+		{
+			dep: "reader",
+			chk: func() bool { return a.reader != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return a.templates != nil },
+		},
+		{
+			dep: "media",
+			chk: func() bool { return a.media != nil },
+		},
+		{
+			dep: "owner",
+			chk: func() bool { return a.cfg.Owner != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize announcer due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Run announces the milestones of the sales detected on the bus until the
+// context is done. Sales dropped by the bus are not announced.
+func (a *Announcer) Run(ctx context.Context, bus *events.Bus) error {
+	sub := bus.Subscribe("milestones", 64)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-sub.Events():
+			detected, ok := e.(events.SaleDetected)
+			if !ok {
+				continue
+			}
+			if err := a.Announce(ctx, detected.Sale); err != nil {
+				a.logger.Error("unable to announce milestones", zap.Error(err), zap.String("saleId", detected.Sale.ID))
+			}
+		}
+	}
+}
+
+// Announce posts the milestones reached by the sale. Milestones already
+// announced are skipped, so announcing a sale again is safe.
+func (a *Announcer) Announce(ctx context.Context, rec sales.Record) error {
+	if rec.SaleTime == nil || rec.Collection == "" || time.Since(*rec.SaleTime) > maxAge {
+		return nil
+	}
+	logger := a.logger.With(zap.String("saleId", rec.ID), zap.String("collection", string(rec.Collection)))
+
+	milestones, err := a.Detect(rec)
+	if err != nil {
+		const msg = "unable to detect milestones"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	var errs error
+	for _, m := range milestones {
+		for _, p := range a.posters {
+			if err := a.post(ctx, logger, p, m); err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Detect returns the milestones reached by the sale, compared to the sales of
+// its collection sold before it
+func (a *Announcer) Detect(rec sales.Record) ([]posts.Milestone, error) {
+	if rec.SaleTime == nil {
+		return nil, nil
+	}
+	var milestones []posts.Milestone
+	before := reader.CursorOf(rec)
+
+	// the first sale of a collection is no high worth announcing
+	high, err := a.reader.TopSales(reader.Filter{Collection: rec.Collection, Before: before, Limit: 1})
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		return nil, err
+	}
+	allTimeHigh := len(high) > 0 && rec.Price > high[0].Price
+	if allTimeHigh {
+		milestones = append(milestones, posts.Milestone{
+			Kind:         posts.AllTimeHigh,
+			Collection:   rec.Collection,
+			Sale:         rec,
+			PreviousHigh: &high[0],
+		})
+	}
+
+	// an all-time high is the top sale of the week too, it's announced once.
+	// The rank is only announced among a full week of N other sales.
+	if n := a.cfg.WeeklyTopN; n > 0 && !allTimeHigh {
+		from := rec.SaleTime.Add(-week)
+		top, err := a.reader.TopSales(reader.Filter{Collection: rec.Collection, From: &from, Before: before, Limit: n})
+		if err != nil && !errors.Is(err, sales.ErrNotFound) {
+			return nil, err
+		}
+
+		rank := 1
+		for i := range top {
+			// ties rank the earlier sale first
+			if top[i].Price >= rec.Price {
+				rank++
+			}
+		}
+		if len(top) == n && rank <= n {
+			milestones = append(milestones, posts.Milestone{
+				Kind:       posts.WeeklyTop,
+				Collection: rec.Collection,
+				Sale:       rec,
+				Rank:       rank,
+			})
+		}
+	}
+
+	if a.cfg.SaleCountStep > 0 || a.cfg.VolumeStep > 0 {
+		count, volume, err := a.reader.Totals(reader.Filter{Collection: rec.Collection, Before: before})
+		if err != nil {
+			return nil, err
+		}
+
+		if step := a.cfg.SaleCountStep; step > 0 && (count+1)%step == 0 {
+			milestones = append(milestones, posts.Milestone{
+				Kind:       posts.SaleCount,
+				Collection: rec.Collection,
+				Sale:       rec,
+				Count:      count + 1,
+			})
+		}
+
+		if step := a.cfg.VolumeStep; step > 0 && (volume+rec.Price)/step > volume/step {
+			milestones = append(milestones, posts.Milestone{
+				Kind:       posts.VolumeReached,
+				Collection: rec.Collection,
+				Sale:       rec,
+				Volume:     (volume + rec.Price) / step * step,
+			})
+		}
+	}
+
+	return milestones, nil
+}
+
+func (a *Announcer) post(ctx context.Context, logger *zap.Logger, p publisher.Poster, m posts.Milestone) error {
+	channel := p.Channel()
+	logger = logger.With(zap.String("channel", string(channel)), zap.String("milestone", string(m.Kind)))
+
+	text, err := a.templates.RenderMilestone(ctx, channel, m)
+	if err != nil {
+		const msg = "unable to render milestone"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	e := ledger.Entry{
+		Key:     key(m, channel),
+		Channel: channel,
+		Details: details{
+			Kind:       m.Kind,
+			Collection: m.Collection,
+			SaleID:     m.Sale.ID,
+		},
+	}
+	err = a.ledger.Claim(&e)
+	switch {
+	case err == nil:
+	case errors.Is(err, ledger.ErrAlreadyPosted):
+		logger.Debug("milestone already announced")
+		return nil
+	default:
+		const msg = "unable to claim milestone"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	// the milestone is still worth announcing without the image
+	media, err := a.media.NFTMedia(ctx, m.Sale, channel)
+	if err != nil {
+		logger.Warn("unable to get sale media", zap.Error(err))
+	}
+
+	id, err := p.Post(ctx, publisher.Post{
+		Title:      m.Headline(),
+		Text:       text,
+		Collection: m.Collection,
+		Media:      media,
+		AltText:    "Image of " + m.Sale.NFT.Name,
+		Key:        e.Key,
+	})
+	if err != nil {
+		// a milestone that may have been posted keeps its claim
+		if errors.Is(err, publisher.ErrNotPosted) {
+			a.ledger.Release(&e)
+		}
+		const msg = "unable to post milestone"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+" to %s: %w", channel, err)
+	}
+
+	if err := a.ledger.Complete(&e, id); err != nil {
+		// the milestone was posted, it won't be posted again as the claim
+		// remains
+		logger.Warn("unable to record announced milestone", zap.Error(err))
+	}
+	logger.Info("announced milestone", zap.String("externalId", id))
+
+	return nil
+}
+
+// key identifies the milestone on the channel. Count and volume milestones
+// are reached once per collection, whichever sale reaches them.
+func key(m posts.Milestone, channel sales.PublishChannel) string {
+	value := m.Sale.ID
+	switch m.Kind {
+	case posts.SaleCount:
+		value = strconv.Itoa(m.Count)
+	case posts.VolumeReached:
+		value = strconv.FormatUint(m.Volume, 10)
+	}
+
+	return "milestone::" + string(m.Kind) + "::" + string(m.Collection) + "::" + value + "::" + string(channel)
+}
@@ -0,0 +1,161 @@
+package posts
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	solscanURL = "https://solscan.io"
+)
+
+// marketplaceURLs are the item pages of the marketplaces, keyed by the
+// marketplace name recorded on the sale. The mint pubkey is appended.
+var marketplaceURLs = map[string]string{
+	"Magic Eden":   "https://magiceden.io/item-details/",
+	"Alpha Art":    "https://alpha.art/t/",
+	"Solsea":       "https://solsea.io/nft/",
+	"Solanart":     "https://solanart.io/nft/",
+	"Digital Eyes": "https://digitaleyes.market/item/",
+	"Exchange Art": "https://exchange.art/single/",
+}
+
+// defaultTemplates are the templates used when no configured template matches
+var defaultTemplates = map[sales.PublishChannel]string{
+	sales.Twitter: `New Bromato Sale!
+Name: {{ .Sale.NFT.Name }}
+{{ with sol .Sale.Price }}Price: {{ . }} SOL
+{{ end }}{{ with .Sale.Marketplace }}Marketplace: {{ . }}
+{{ end }}{{ with .Sale.SaleTime }}Sale Time: {{ utc . }}
+{{ end }}Transaction: {{ solscanTx .Sale.ID }}
+#Bromato`,
+
+	sales.Discord: `**{{ .Sale.NFT.Name }}** sold{{ with sol .Sale.Price }} for **{{ . }} SOL**{{ end }}
+{{- with usd .Sale.Price .SOLUSD }} ({{ . }}){{ end }}
+{{- with .Sale.Marketplace }} on [{{ . }}]({{ marketplaceURL . $.Sale.MintPubkey }}){{ end }}
+{{- with rarity .Sale.MintPubkey }}
+Rarity rank: {{ . }}{{ end }}`,
+
+	sales.Telegram: `*New Bromato Sale\!*
+*Name:* {{ md .Sale.NFT.Name }}
+{{ with sol .Sale.Price }}*Price:* {{ md . }} SOL
+{{ end }}{{ with .Sale.Marketplace }}*Marketplace:* {{ md . }}
+{{ end }}{{ with .Sale.SaleTime }}*Sale Time:* {{ md (utc .) }}
+{{ end }}[View transaction]({{ mdURL (solscanTx .Sale.ID) }})`,
+
+	sales.Slack: `*{{ .Sale.NFT.Name }}*
+{{- with usd .Sale.Price .SOLUSD }} sold for {{ . }}{{ end }}
+{{- with rarity .Sale.MintPubkey }} · Rarity rank {{ . }}{{ end }}
+{{- with .Sale.Marketplace }} · <{{ marketplaceURL . $.Sale.MintPubkey }}|View on {{ . }}>{{ end }}`,
+
+	sales.Mastodon: `New Bromato Sale!
+Name: {{ .Sale.NFT.Name }}
+{{ with sol .Sale.Price }}Price: {{ . }} SOL
+{{ end }}{{ with .Sale.Marketplace }}Marketplace: {{ . }}
+{{ end }}{{ with .Sale.SaleTime }}Sale Time: {{ utc . }}
+{{ end }}Transaction: {{ solscanTx .Sale.ID }}
+#Bromato #NFT #Solana`,
+}
+
+func (t *Templates) funcs() template.FuncMap {
+	return template.FuncMap{
+		// sol formats lamports as SOL, empty for dust prices
+		"sol": sales.ToSolPriceStr,
+
+		// usd formats lamports as USD at the SOL/USD price, empty when the
+		// price is unknown
+		"usd": func(lamports uint64, solUSD float64) string {
+			if solUSD <= 0 {
+				return ""
+			}
+			return FormatUSD(float64(lamports) / sales.LamportsPerSOL * solUSD)
+		},
+
+		// shortAddr shortens an address e.g. 5ufx...bu7n
+		"shortAddr": ShortenAddress,
+
+		"solscanTx": func(signature string) string {
+			return solscanURL + "/tx/" + signature
+		},
+		"solscanAccount": func(address string) string {
+			return solscanURL + "/account/" + address
+		},
+
+		// marketplaceURL returns the marketplace page of the mint, falling
+		// back to solscan for unknown marketplaces
+		"marketplaceURL": func(marketplace string, mint string) string {
+			if u, ok := marketplaceURLs[marketplace]; ok {
+				return u + mint
+			}
+			return solscanURL + "/token/" + mint
+		},
+
+		// rarity returns the rarity rank of the mint e.g. #12, empty when
+		// unknown
+		"rarity": func(mint string) string {
+			rank, ok := t.rarity[mint]
+			if !ok {
+				return ""
+			}
+			return "#" + strconv.Itoa(rank)
+		},
+
+		"utc": func(t *time.Time) string {
+			return t.UTC().String()
+		},
+
+		// md and mdURL escape text and link URLs for Telegram's MarkdownV2
+		"md":    EscapeMarkdownV2,
+		"mdURL": EscapeMarkdownV2URL,
+	}
+}
+
+// ShortenAddress shortens a base58 address for display e.g. 5ufx...bu7n
+func ShortenAddress(address string) string {
+	if len(address) <= 8 {
+		return address
+	}
+
+	return address[:4] + "..." + address[len(address)-4:]
+}
+
+// FormatUSD formats the amount as dollars with thousands separators e.g.
+// $1,234.56
+func FormatUSD(amount float64) string {
+	cents := int64(math.Round(amount * 100))
+	whole := strconv.FormatInt(cents/100, 10)
+
+	var b strings.Builder
+	for i := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte(whole[i])
+	}
+
+	return "$" + b.String() + "." + strconv.FormatInt(100+cents%100, 10)[1:]
+}
+
+// markdownV2Replacer escapes the characters reserved by Telegram's MarkdownV2
+var markdownV2Replacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// EscapeMarkdownV2 escapes text so it is rendered literally in a MarkdownV2
+// formatted message
+func EscapeMarkdownV2(text string) string {
+	return markdownV2Replacer.Replace(text)
+}
+
+// EscapeMarkdownV2URL escapes the URL of an inline link, inside of which only
+// ')' and '\' need to be escaped
+func EscapeMarkdownV2URL(u string) string {
+	return strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(u)
+}
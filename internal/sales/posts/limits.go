@@ -0,0 +1,93 @@
+package posts
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"bromato-sales/internal/sales"
+)
+
+// shortenedURLLength is the length every URL counts as on channels that
+// shorten links, e.g. twitter's t.co and mastodon
+const shortenedURLLength = 23
+
+// limit is the maximum length of a post on a channel
+type limit struct {
+	max int
+
+	// shortensURLs communicates the channel counts every URL as
+	// shortenedURLLength
+	shortensURLs bool
+
+	// weighted communicates the channel counts characters outside of the
+	// latin ranges twice, as twitter does
+	weighted bool
+}
+
+// limits are the post length limits of the channels. Channels without a limit
+// are not validated.
+var limits = map[sales.PublishChannel]limit{
+	sales.Twitter:  {max: 280, shortensURLs: true, weighted: true},
+	sales.Mastodon: {max: 500, shortensURLs: true},
+	// photo captions are limited to 1024 characters after entity parsing,
+	// counting the escapes as well keeps us on the safe side
+	sales.Telegram: {max: 1024},
+	sales.Discord:  {max: 4096},
+	sales.Slack:    {max: 3000},
+}
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>|)]+`)
+
+// ValidateLength returns an error if the text exceeds the channel's limit
+func ValidateLength(channel sales.PublishChannel, text string) error {
+	l, ok := limits[channel]
+	if !ok {
+		return nil
+	}
+
+	if n := postLength(l, text); n > l.max {
+		return fmt.Errorf("%s post length %d exceeds limit of %d", channel, n, l.max)
+	}
+
+	return nil
+}
+
+func postLength(l limit, text string) int {
+	var n int
+	if l.shortensURLs {
+		for {
+			loc := urlRegexp.FindStringIndex(text)
+			if loc == nil {
+				break
+			}
+			n += shortenedURLLength
+			text = text[:loc[0]] + text[loc[1]:]
+		}
+	}
+
+	if !l.weighted {
+		return n + utf8.RuneCountInString(text)
+	}
+
+	for _, r := range text {
+		n += runeWeight(r)
+	}
+
+	return n
+}
+
+// runeWeight returns the weight of the rune as counted by twitter, characters
+// in the latin, general punctuation and spacing ranges count once while
+// everything else, e.g. CJK and emoji, counts twice
+func runeWeight(r rune) int {
+	switch {
+	case r <= 0x10FF,
+		r >= 0x2000 && r <= 0x200D,
+		r >= 0x2010 && r <= 0x201F,
+		r >= 0x2032 && r <= 0x2037:
+		return 1
+	default:
+		return 2
+	}
+}
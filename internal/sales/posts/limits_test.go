@@ -0,0 +1,109 @@
+package posts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"bromato-sales/internal/sales"
+)
+
+func TestValidateLength(t *testing.T) {
+	url := "https://solscan.io/tx/" + strings.Repeat("5", 88)
+
+	for _, tc := range []struct {
+		name    string
+		channel sales.PublishChannel
+		text    string
+		valid   bool
+	}{
+		{
+			name:    "twitter at the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("a", 280),
+			valid:   true,
+		},
+		{
+			name:    "twitter over the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("a", 281),
+		},
+		{
+			// CJK counts twice
+			name:    "twitter weighted at the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("売", 140),
+			valid:   true,
+		},
+		{
+			name:    "twitter weighted over the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("売", 140) + "a",
+		},
+		{
+			// punctuation such as the em dash counts once
+			name:    "twitter punctuation",
+			channel: sales.Twitter,
+			text:    strings.Repeat("—", 280),
+			valid:   true,
+		},
+		{
+			// the url counts as the 23 characters of a t.co link
+			name:    "twitter url at the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("a", 256) + " " + url,
+			valid:   true,
+		},
+		{
+			name:    "twitter url over the limit",
+			channel: sales.Twitter,
+			text:    strings.Repeat("a", 257) + " " + url,
+		},
+		{
+			name:    "twitter urls",
+			channel: sales.Twitter,
+			text:    strings.Repeat("a", 232) + " " + url + " " + url,
+			valid:   true,
+		},
+		{
+			// mastodon shortens urls without weighting characters
+			name:    "mastodon",
+			channel: sales.Mastodon,
+			text:    strings.Repeat("売", 476) + " " + url,
+			valid:   true,
+		},
+		{
+			name:    "mastodon over the limit",
+			channel: sales.Mastodon,
+			text:    strings.Repeat("売", 477) + " " + url,
+		},
+		{
+			// telegram counts the url in full
+			name:    "telegram url",
+			channel: sales.Telegram,
+			text:    strings.Repeat("a", 1024-len(url)) + url,
+			valid:   true,
+		},
+		{
+			name:    "telegram url over the limit",
+			channel: sales.Telegram,
+			text:    strings.Repeat("a", 1025-len(url)) + url,
+		},
+		{
+			name:    "channel without a limit",
+			channel: sales.Webhook,
+			text:    strings.Repeat("a", 10000),
+			valid:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLength(tc.channel, tc.text)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
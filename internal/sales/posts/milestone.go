@@ -0,0 +1,134 @@
+package posts
+
+import (
+	"strconv"
+
+	"bromato-sales/internal/sales"
+)
+
+// MilestoneKind is the kind of notable event a milestone announces
+type MilestoneKind string
+
+const (
+	// AllTimeHigh is a sale priced above every previous sale of the collection
+	AllTimeHigh MilestoneKind = "all-time-high"
+
+	// WeeklyTop is a sale ranking among the top sales of the past week
+	WeeklyTop MilestoneKind = "weekly-top"
+
+	// SaleCount is the sale reaching a round number of sales of the collection
+	SaleCount MilestoneKind = "sale-count"
+
+	// VolumeReached is the sale taking the collection's volume past a round
+	// amount of SOL
+	VolumeReached MilestoneKind = "volume"
+)
+
+// Milestone is a notable event reached by a sale
+type Milestone struct {
+	Kind MilestoneKind
+
+	Collection sales.NFTCollection
+
+	// Sale is the sale reaching the milestone
+	Sale sales.Record
+
+	// Rank is the rank of the sale among the top sales of the week, set for
+	// WeeklyTop
+	Rank int
+
+	// Count is the number of sales of the collection, including the sale, set
+	// for SaleCount
+	Count int
+
+	// Volume is the volume reached in lamports, set for VolumeReached
+	Volume uint64
+
+	// PreviousHigh is the sale holding the all-time high until the sale, set
+	// for AllTimeHigh
+	PreviousHigh *sales.Record
+}
+
+// Headline returns the title of the milestone e.g. 1000th Sale
+func (m Milestone) Headline() string {
+	switch m.Kind {
+	case AllTimeHigh:
+		return "New All-Time High"
+	case WeeklyTop:
+		return "#" + strconv.Itoa(m.Rank) + " Sale of the Week"
+	case SaleCount:
+		return ordinal(m.Count) + " Sale"
+	case VolumeReached:
+		return sales.ToSolPriceStr(m.Volume) + " SOL Volume"
+	default:
+		return "Milestone"
+	}
+}
+
+// ordinal formats n as an ordinal number e.g. 1st, 12th, 103rd
+func ordinal(n int) string {
+	s := strconv.Itoa(n)
+	if n%100 >= 11 && n%100 <= 13 {
+		return s + "th"
+	}
+
+	switch n % 10 {
+	case 1:
+		return s + "st"
+	case 2:
+		return s + "nd"
+	case 3:
+		return s + "rd"
+	default:
+		return s + "th"
+	}
+}
+
+// defaultMilestoneTemplates are the milestone templates used when no
+// configured template matches
+var defaultMilestoneTemplates = map[sales.PublishChannel]string{
+	sales.Twitter: `{{ .Milestone.Headline }}!
+{{ .Sale.NFT.Name }} sold{{ with sol .Sale.Price }} for {{ . }} SOL{{ end }}{{ with .Sale.Marketplace }} on {{ . }}{{ end }}
+{{ with .Milestone.PreviousHigh }}{{ with sol .Price }}Previous High: {{ . }} SOL
+{{ end }}{{ end }}Transaction: {{ solscanTx .Sale.ID }}
+#Bromato`,
+
+	sales.Discord: `**{{ .Sale.NFT.Name }}** sold{{ with sol .Sale.Price }} for **{{ . }} SOL**{{ end }}
+{{- with usd .Sale.Price .SOLUSD }} ({{ . }}){{ end }}
+{{- with .Sale.Marketplace }} on [{{ . }}]({{ marketplaceURL . $.Sale.MintPubkey }}){{ end }}
+{{- with .Milestone.PreviousHigh }}{{ with sol .Price }}
+**Previous High:** {{ . }} SOL{{ end }}{{ end }}
+[View transaction]({{ solscanTx .Sale.ID }})`,
+
+	sales.Telegram: `*{{ md .Milestone.Headline }}\!*
+*Name:* {{ md .Sale.NFT.Name }}
+{{ with sol .Sale.Price }}*Price:* {{ md . }} SOL
+{{ end }}{{ with .Sale.Marketplace }}*Marketplace:* {{ md . }}
+{{ end }}{{ with .Milestone.PreviousHigh }}{{ with sol .Price }}*Previous High:* {{ md . }} SOL
+{{ end }}{{ end }}[View transaction]({{ mdURL (solscanTx .Sale.ID) }})`,
+
+	sales.Slack: `*{{ .Sale.NFT.Name }}*{{ with sol .Sale.Price }} sold for {{ . }} SOL{{ end }}
+{{- with .Milestone.PreviousHigh }}{{ with sol .Price }} · Previous high {{ . }} SOL{{ end }}{{ end }}
+{{- with .Sale.Marketplace }} · <{{ marketplaceURL . $.Sale.MintPubkey }}|View on {{ . }}>{{ end }}`,
+
+	sales.Mastodon: `{{ .Milestone.Headline }}!
+{{ .Sale.NFT.Name }} sold{{ with sol .Sale.Price }} for {{ . }} SOL{{ end }}{{ with .Sale.Marketplace }} on {{ . }}{{ end }}
+{{ with .Milestone.PreviousHigh }}{{ with sol .Price }}Previous High: {{ . }} SOL
+{{ end }}{{ end }}Transaction: {{ solscanTx .Sale.ID }}
+#Bromato #NFT #Solana`,
+}
+
+// sampleMilestone is a milestone with values at the long end of what is
+// expected, used to validate the templates
+var sampleMilestone = func() Milestone {
+	previous := sampleRecord
+	return Milestone{
+		Kind:         AllTimeHigh,
+		Collection:   sampleRecord.Collection,
+		Sale:         sampleRecord,
+		Rank:         10,
+		Count:        1000000,
+		Volume:       123456789012345,
+		PreviousHigh: &previous,
+	}
+}()
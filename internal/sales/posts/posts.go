@@ -0,0 +1,368 @@
+package posts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+// Templates renders the text of the posts published for a sale, and of the
+// other kinds of posts such as recaps. Templates are text/template templates
+// selected by their kind, the collection and the channel being published to,
+// falling back to the built in channel defaults of the kind.
+type Templates struct {
+	entries []entry
+	logger  *zap.Logger
+	prices  PriceSource
+	rarity  map[string]int
+}
+
+// Config is the configuration of the post templates
+type Config struct {
+	// Templates override the default templates
+	Templates []TemplateConfig `json:"templates"`
+
+	// Rarity maps a mint pubkey to its rarity rank within its collection
+	Rarity map[string]int `json:"-"`
+
+	// Prices is the source of the SOL/USD price, optional
+	Prices PriceSource `json:"-"`
+}
+
+// TemplateConfig is a single post template. An empty collection or channel
+// matches any collection or channel, the most specific template is used. An
+// empty kind is a sale template.
+type TemplateConfig struct {
+	Kind       Kind                 `json:"kind"`
+	Collection sales.NFTCollection  `json:"collection"`
+	Channel    sales.PublishChannel `json:"channel"`
+	Text       string               `json:"text"`
+}
+
+// Kind is the kind of post a template renders
+type Kind string
+
+const (
+	// KindSale templates render the post of a sale
+	KindSale Kind = "sale"
+
+	// KindRecap templates render the recap of the sales over a period
+	KindRecap Kind = "recap"
+
+	// KindMilestone templates render the announcement of a sale reaching a
+	// milestone
+	KindMilestone Kind = "milestone"
+)
+
+// defaults are the default templates of each kind
+var defaults = map[Kind]map[sales.PublishChannel]string{
+	KindSale:      defaultTemplates,
+	KindRecap:     defaultRecapTemplates,
+	KindMilestone: defaultMilestoneTemplates,
+}
+
+// Data is the data available to the templates
+type Data struct {
+	// Sale is the sale being published, set for sale and milestone templates
+	Sale sales.Record
+
+	// Recap is the recap being published, set for recap templates
+	Recap *Recap
+
+	// Milestone is the milestone being announced, set for milestone templates
+	Milestone *Milestone
+
+	// SOLUSD is the SOL/USD price at render time, 0 when unknown
+	SOLUSD float64
+}
+
+type entry struct {
+	kind       Kind
+	collection sales.NFTCollection
+	channel    sales.PublishChannel
+	tmpl       *template.Template
+}
+
+func NewTemplates(logger *zap.Logger, cfg Config) (*Templates, error) {
+	t := Templates{
+		logger: logger,
+		prices: cfg.Prices,
+		rarity: cfg.Rarity,
+	}
+
+	if t.logger == nil {
+		return nil, fmt.Errorf("unable to initialize templates due to (1) missing dependencies: logger")
+	}
+
+	for i := range cfg.Templates {
+		if cfg.Templates[i].Kind == "" {
+			cfg.Templates[i].Kind = KindSale
+		}
+		tc := cfg.Templates[i]
+		if _, ok := defaults[tc.Kind]; !ok {
+			return nil, fmt.Errorf("unknown template kind: %s", tc.Kind)
+		}
+
+		tmpl, err := t.parse(tc.Kind, tc.Collection, tc.Channel, tc.Text)
+		if err != nil {
+			return nil, err
+		}
+		t.entries = append(t.entries, entry{kind: tc.Kind, collection: tc.Collection, channel: tc.Channel, tmpl: tmpl})
+	}
+
+	for kind, templates := range defaults {
+		for channel, text := range templates {
+			tmpl, err := t.parse(kind, "", channel, text)
+			if err != nil {
+				return nil, err
+			}
+			t.entries = append(t.entries, entry{kind: kind, channel: channel, tmpl: tmpl})
+		}
+	}
+
+	if err := t.validate(cfg.Templates); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// ReadConfig reads the template configuration from a JSON file of the form
+// {"templates": [{"kind": "...", "collection": "...", "channel": "...", "text": "..."}]}
+func ReadConfig(path string) (Config, error) {
+	var cfg Config
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read templates file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to decode templates file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ReadRarity reads the rarity ranks from a JSON file mapping mint pubkeys to
+// their rank e.g. {"<mint>": 12}
+func ReadRarity(path string) (map[string]int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rarity file: %w", err)
+	}
+
+	var ranks map[string]int
+	if err := json.Unmarshal(b, &ranks); err != nil {
+		return nil, fmt.Errorf("unable to decode rarity file: %w", err)
+	}
+
+	return ranks, nil
+}
+
+// Render renders the post text of the sale for the channel. An error is
+// returned when the text exceeds the channel's length limit.
+func (t *Templates) Render(ctx context.Context, channel sales.PublishChannel, record sales.Record) (string, error) {
+	data := t.data(ctx)
+	data.Sale = record
+
+	return t.render(KindSale, record.Collection, channel, data)
+}
+
+// RenderRecap renders the post text of the recap for the channel. An error is
+// returned when the text exceeds the channel's length limit.
+func (t *Templates) RenderRecap(ctx context.Context, channel sales.PublishChannel, recap Recap) (string, error) {
+	data := t.data(ctx)
+	data.Recap = &recap
+
+	return t.render(KindRecap, recap.Collection, channel, data)
+}
+
+// RenderMilestone renders the announcement of the milestone for the channel.
+// An error is returned when the text exceeds the channel's length limit.
+func (t *Templates) RenderMilestone(ctx context.Context, channel sales.PublishChannel, milestone Milestone) (string, error) {
+	data := t.data(ctx)
+	data.Sale = milestone.Sale
+	data.Milestone = &milestone
+
+	return t.render(KindMilestone, milestone.Collection, channel, data)
+}
+
+func (t *Templates) render(kind Kind, collection sales.NFTCollection, channel sales.PublishChannel, data Data) (string, error) {
+	tmpl := t.lookup(kind, collection, channel)
+	if tmpl == nil {
+		return "", fmt.Errorf("no %s template for channel: %s", kind, channel)
+	}
+
+	text, err := execute(tmpl, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ValidateLength(channel, text); err != nil {
+		return "", err
+	}
+
+	return text, nil
+}
+
+// Parse parses text as a template with the functions available to the post
+// templates, allowing other renderings of a sale, e.g. sale cards, to share
+// the post template syntax
+func (t *Templates) Parse(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(t.funcs()).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template %s: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Execute executes a template created by Parse, or a post template, for the
+// sale
+func (t *Templates) Execute(ctx context.Context, tmpl *template.Template, record sales.Record) (string, error) {
+	data := t.data(ctx)
+	data.Sale = record
+
+	return execute(tmpl, data)
+}
+
+// data returns the data shared by every kind of template
+func (t *Templates) data(ctx context.Context) Data {
+	var data Data
+	if t.prices != nil {
+		price, err := t.prices.SOLUSD(ctx)
+		if err != nil {
+			// the post is still worth publishing without the USD price
+			t.logger.Warn("unable to get SOL/USD price", zap.Error(err))
+		}
+		data.SOLUSD = price
+	}
+
+	return data
+}
+
+// lookup returns the most specific template of the kind for the collection
+// and channel
+func (t *Templates) lookup(kind Kind, collection sales.NFTCollection, channel sales.PublishChannel) *template.Template {
+	var (
+		best  *template.Template
+		score = -1
+	)
+	for i := range t.entries {
+		e := t.entries[i]
+		if e.kind != kind {
+			continue
+		}
+		if (e.collection != "" && e.collection != collection) || (e.channel != "" && e.channel != channel) {
+			continue
+		}
+
+		// a collection match outranks a channel match as collections usually
+		// want their own branding on every channel
+		var s int
+		if e.collection != "" {
+			s += 2
+		}
+		if e.channel != "" {
+			s++
+		}
+		if s > score {
+			best, score = e.tmpl, s
+		}
+	}
+
+	return best
+}
+
+// validate renders the configured templates against a sample sale, recap or
+// milestone, to catch broken templates, and templates exceeding the channel
+// limits, at startup
+func (t *Templates) validate(templates []TemplateConfig) error {
+	for _, tc := range templates {
+		channels := []sales.PublishChannel{tc.Channel}
+		if tc.Channel == "" {
+			channels = channels[:0]
+			for channel := range defaults[tc.Kind] {
+				channels = append(channels, channel)
+			}
+		}
+
+		data := Data{Sale: sampleRecord, SOLUSD: 100}
+		if tc.Collection != "" {
+			data.Sale.Collection = tc.Collection
+		}
+		if tc.Kind == KindRecap {
+			recap := sampleRecap
+			recap.Collection = data.Sale.Collection
+			data.Recap = &recap
+		}
+		if tc.Kind == KindMilestone {
+			milestone := sampleMilestone
+			milestone.Collection = data.Sale.Collection
+			milestone.Sale = data.Sale
+			data.Milestone = &milestone
+		}
+
+		for _, channel := range channels {
+			text, err := execute(t.lookup(tc.Kind, data.Sale.Collection, channel), data)
+			if err != nil {
+				return fmt.Errorf("invalid %s %s template for collection %q: %w", channel, tc.Kind, tc.Collection, err)
+			}
+			if err := ValidateLength(channel, text); err != nil {
+				return fmt.Errorf("invalid %s %s template for collection %q: %w", channel, tc.Kind, tc.Collection, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Templates) parse(
+	kind Kind,
+	collection sales.NFTCollection,
+	channel sales.PublishChannel,
+	text string) (*template.Template, error) {
+	return t.Parse(string(kind)+"/"+string(collection)+"/"+string(channel), text)
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("unable to execute template %s: %w", tmpl.Name(), err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// sampleRecord is a sale with values at the long end of what is expected, used
+// to validate the templates
+var sampleRecord = func() sales.Record {
+	saleTime := time.Date(2021, time.December, 31, 23, 59, 59, 0, time.UTC)
+	return sales.Record{
+		ID:          strings.Repeat("5", 88),
+		Buyer:       strings.Repeat("B", 44),
+		Seller:      strings.Repeat("S", 44),
+		Collection:  "bad-bromatoes",
+		Marketplace: "Digital Eyes",
+		MintPubkey:  strings.Repeat("M", 44),
+		Price:       1234567890123,
+		SaleTime:    &saleTime,
+		NFT: sales.NFT{
+			Name:   "Bad Bromato #10000",
+			Symbol: "BROMATO",
+		},
+	}
+}()
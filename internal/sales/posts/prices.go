@@ -0,0 +1,103 @@
+package posts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// CoinGeckoPriceURL is the CoinGecko simple price endpoint for SOL/USD
+	CoinGeckoPriceURL = "https://api.coingecko.com/api/v3/simple/price?ids=solana&vs_currencies=usd"
+
+	// priceTTL is how long a fetched price is used before fetching it again
+	priceTTL = time.Minute * 5
+)
+
+// PriceSource provides the SOL/USD price
+type PriceSource interface {
+	SOLUSD(ctx context.Context) (float64, error)
+}
+
+// CoinGecko is a PriceSource backed by the CoinGecko API. Prices are cached
+// to stay well within the API's rate limits.
+type CoinGecko struct {
+	client *http.Client
+	url    string
+
+	mu        sync.Mutex
+	price     float64
+	fetchedAt time.Time
+}
+
+func NewCoinGecko(url string) *CoinGecko {
+	if url == "" {
+		url = CoinGeckoPriceURL
+	}
+
+	return &CoinGecko{
+		client: &http.Client{Timeout: time.Second * 10},
+		url:    url,
+	}
+}
+
+// SOLUSD returns the SOL/USD price. A stale price is returned, along with the
+// error, when the price can't be refreshed.
+func (c *CoinGecko) SOLUSD(ctx context.Context) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < priceTTL {
+		return c.price, nil
+	}
+
+	price, err := c.fetch(ctx)
+	if err != nil {
+		return c.price, err
+	}
+	c.price = price
+	c.fetchedAt = time.Now()
+
+	return price, nil
+}
+
+func (c *CoinGecko) fetch(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create price request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get price: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read price response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("received non-200 response from coingecko: %d", resp.StatusCode)
+	}
+
+	var r struct {
+		Solana struct {
+			USD float64 `json:"usd"`
+		} `json:"solana"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return 0, fmt.Errorf("unable to decode price response: %w", err)
+	}
+
+	if r.Solana.USD <= 0 {
+		return 0, fmt.Errorf("invalid SOL/USD price: %f", r.Solana.USD)
+	}
+
+	return r.Solana.USD, nil
+}
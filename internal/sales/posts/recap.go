@@ -0,0 +1,124 @@
+package posts
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"bromato-sales/internal/sales"
+)
+
+// Recap is the summary of a collection's sales over a period, along with the
+// previous period of the same length for comparison
+type Recap struct {
+	// Period is the title of the period e.g. Daily
+	Period string
+
+	Collection sales.NFTCollection
+
+	// From and To are the start and end of the period, To is exclusive
+	From time.Time
+	To   time.Time
+
+	// Count and Volume are the number of sales and their total price in
+	// lamports
+	Count  int
+	Volume uint64
+
+	// PreviousCount and PreviousVolume are those of the previous period
+	PreviousCount  int
+	PreviousVolume uint64
+
+	// TopSale is the highest priced sale of the period
+	TopSale *sales.Record
+
+	// TopMarketplace is the marketplace with the most sales in the period
+	TopMarketplace      string
+	TopMarketplaceCount int
+}
+
+// CountChange returns the change in the number of sales from the previous
+// period e.g. +25%, empty when there were no sales in the previous period
+func (r Recap) CountChange() string {
+	return percentChange(float64(r.Count), float64(r.PreviousCount))
+}
+
+// VolumeChange returns the change in volume from the previous period e.g.
+// -10.5%, empty when there were no sales in the previous period
+func (r Recap) VolumeChange() string {
+	return percentChange(float64(r.Volume), float64(r.PreviousVolume))
+}
+
+func percentChange(cur float64, prev float64) string {
+	if prev == 0 {
+		return ""
+	}
+
+	change := math.Round((cur-prev)/prev*1000) / 10
+	s := strconv.FormatFloat(change, 'f', -1, 64) + "%"
+	if change >= 0 {
+		s = "+" + s
+	}
+
+	return s
+}
+
+// defaultRecapTemplates are the recap templates used when no configured
+// template matches
+var defaultRecapTemplates = map[sales.PublishChannel]string{
+	sales.Twitter: `{{ .Recap.Period }} Bromato Recap
+Sales: {{ .Recap.Count }}{{ with .Recap.CountChange }} ({{ . }}){{ end }}
+{{ with sol .Recap.Volume }}Volume: {{ . }} SOL{{ with $.Recap.VolumeChange }} ({{ . }}){{ end }}
+{{ end }}{{ with .Recap.TopSale }}Top Sale: {{ .NFT.Name }}{{ with sol .Price }} for {{ . }} SOL{{ end }}
+{{ end }}{{ with .Recap.TopMarketplace }}Most Active Marketplace: {{ . }}
+{{ end }}#Bromato`,
+
+	sales.Discord: `**Sales:** {{ .Recap.Count }}{{ with .Recap.CountChange }} ({{ . }}){{ end }}
+{{- with sol .Recap.Volume }}
+**Volume:** {{ . }} SOL{{ with $.Recap.VolumeChange }} ({{ . }}){{ end }}{{ end }}
+{{- with usd .Recap.Volume .SOLUSD }} ({{ . }}){{ end }}
+{{- with .Recap.TopSale }}
+**Top Sale:** [{{ .NFT.Name }}]({{ solscanTx .ID }}){{ with sol .Price }} for {{ . }} SOL{{ end }}{{ end }}
+{{- with .Recap.TopMarketplace }}
+**Most Active Marketplace:** {{ . }} ({{ $.Recap.TopMarketplaceCount }} sales){{ end }}`,
+
+	sales.Telegram: `*{{ md .Recap.Period }} Bromato Recap*
+*Sales:* {{ .Recap.Count }}{{ with .Recap.CountChange }} {{ md (printf "(%s)" .) }}{{ end }}
+{{ with sol .Recap.Volume }}*Volume:* {{ md . }} SOL{{ with $.Recap.VolumeChange }} {{ md (printf "(%s)" .) }}{{ end }}
+{{ end }}{{ with .Recap.TopSale }}*Top Sale:* [{{ md .NFT.Name }}]({{ mdURL (solscanTx .ID) }}){{ with sol .Price }} for {{ md . }} SOL{{ end }}
+{{ end }}{{ with .Recap.TopMarketplace }}*Most Active Marketplace:* {{ md . }}{{ end }}`,
+
+	sales.Slack: `*Sales:* {{ .Recap.Count }}{{ with .Recap.CountChange }} ({{ . }}){{ end }}
+{{- with sol .Recap.Volume }}
+*Volume:* {{ . }} SOL{{ with $.Recap.VolumeChange }} ({{ . }}){{ end }}{{ end }}
+{{- with .Recap.TopSale }}
+*Top Sale:* <{{ solscanTx .ID }}|{{ .NFT.Name }}>{{ with sol .Price }} for {{ . }} SOL{{ end }}{{ end }}
+{{- with .Recap.TopMarketplace }}
+*Most Active Marketplace:* {{ . }}{{ end }}`,
+
+	sales.Mastodon: `{{ .Recap.Period }} Bromato Recap
+Sales: {{ .Recap.Count }}{{ with .Recap.CountChange }} ({{ . }}){{ end }}
+{{ with sol .Recap.Volume }}Volume: {{ . }} SOL{{ with $.Recap.VolumeChange }} ({{ . }}){{ end }}
+{{ end }}{{ with .Recap.TopSale }}Top Sale: {{ .NFT.Name }}{{ with sol .Price }} for {{ . }} SOL{{ end }}
+{{ end }}{{ with .Recap.TopMarketplace }}Most Active Marketplace: {{ . }}
+{{ end }}#Bromato #NFT #Solana`,
+}
+
+// sampleRecap is a recap with values at the long end of what is expected,
+// used to validate the templates
+var sampleRecap = func() Recap {
+	top := sampleRecord
+	return Recap{
+		Period:              "Weekly",
+		Collection:          sampleRecord.Collection,
+		From:                top.SaleTime.Add(-7 * 24 * time.Hour),
+		To:                  *top.SaleTime,
+		Count:               12345,
+		Volume:              123456789012345,
+		PreviousCount:       1,
+		PreviousVolume:      1,
+		TopSale:             &top,
+		TopMarketplace:      "Digital Eyes",
+		TopMarketplaceCount: 12345,
+	}
+}()
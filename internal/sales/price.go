@@ -0,0 +1,33 @@
+package sales
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LamportsPerSOL is the number of lamports in one SOL
+const LamportsPerSOL = 1000000000
+
+// ToSolPriceStr converts a price in lamports to its SOL representation e.g.
+// 1500000000 -> 1.5. Prices under .04 SOL return an empty string.
+func ToSolPriceStr(price uint64) string {
+	if price < 40000000 {
+		return ""
+	}
+
+	return FormatSOL(price)
+}
+
+// FormatSOL formats a price in lamports as SOL without trailing zeros e.g.
+// 1500000000 -> 1.5
+func FormatSOL(lamports uint64) string {
+	whole := strconv.FormatUint(lamports/LamportsPerSOL, 10)
+
+	frac := lamports % LamportsPerSOL
+	if frac == 0 {
+		return whole
+	}
+
+	return whole + "." + strings.TrimRight(fmt.Sprintf("%09d", frac), "0")
+}
@@ -0,0 +1,431 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+const (
+	// discordEmbedColor is the bromato red used as the embed accent
+	discordEmbedColor = 0xE0312B
+
+	// maxDiscordRetries is the number of times a webhook is retried after
+	// being rate limited by Discord
+	maxDiscordRetries = 3
+)
+
+// Discord publishes sales as rich embeds to one or more Discord webhooks
+type Discord struct {
+	client      *http.Client
+	logger      *zap.Logger
+	templates   *posts.Templates
+	webhookURLs []string
+}
+
+func NewDiscord(logger *zap.Logger, templates *posts.Templates, webhookURLs []string) (*Discord, error) {
+	d := Discord{
+		client:      &http.Client{Timeout: time.Second * 30},
+		logger:      logger,
+		templates:   templates,
+		webhookURLs: webhookURLs,
+	}
+
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (d *Discord) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return d.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return d.templates != nil },
+		},
+		{
+			dep: "webhookURLs",
+			chk: func() bool { return len(d.webhookURLs) > 0 },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize discord publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the discord publish channel
+func (d *Discord) Channel() sales.PublishChannel { return sales.Discord }
+
+// Publish posts the sale embed to every webhook, but those posted to by a
+// previous attempt. The returned ID is the comma separated list of
+// webhookID:messageID pairs.
+func (d *Discord) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := d.logger.With(zap.String("saleId", record.ID))
+
+	description, err := d.templates.Render(ctx, sales.Discord, record)
+	if err != nil {
+		const msg = "unable to render embed description"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	msg := discordMessage{
+		Embeds: []discordEmbed{d.saleEmbed(record, description, media)},
+	}
+
+	return d.executeAll(ctx, logger, sentIDs(record, sales.Discord), msg, media)
+}
+
+// Post posts the text as an embed to every webhook, with the media as its
+// image. The returned ID is the comma separated list of webhookID:messageID
+// pairs.
+func (d *Discord) Post(ctx context.Context, post Post) (string, error) {
+	embed := discordEmbed{
+		Title:       post.Title,
+		Description: post.Text,
+		Color:       discordEmbedColor,
+	}
+	if post.Media != nil {
+		embed.Image = &discordImage{URL: "attachment://" + mediaFilename(post.Media)}
+	}
+
+	return d.executeAll(ctx, d.logger, make(map[string]string), discordMessage{Embeds: []discordEmbed{embed}}, post.Media)
+}
+
+// Verify gets every webhook, deleted webhooks and invalid tokens are rejected
+func (d *Discord) Verify(ctx context.Context) error {
+	for i := range d.webhookURLs {
+		logger := d.logger.With(zap.Int("webhook", i))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.webhookURLs[i], nil)
+		if err != nil {
+			const msg = "unable to create webhook request"
+			logger.Error(msg, zap.Error(err))
+			return fmt.Errorf(msg+": %w", err)
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			// the error contains the url which contains the webhook token
+			const msg = "unable to get webhook"
+			logger.Error(msg)
+			return fmt.Errorf(msg+": %d", i)
+		}
+		_, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			const msg = "received non-200 response from discord"
+			logger.Error(msg, zap.Int("status", resp.StatusCode))
+			return fmt.Errorf(msg+" for webhook %d: %d", i, resp.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+// executeAll executes every webhook but those in sent, the message IDs by
+// webhook ID of a previous attempt. When a webhook fails the ID of the
+// messages sent so far is returned along with the error, which doesn't match
+// ErrNotPosted once a message was sent.
+func (d *Discord) executeAll(
+	ctx context.Context,
+	logger *zap.Logger,
+	sent map[string]string,
+	msg discordMessage,
+	media *Media) (string, error) {
+	webhooks := make([]string, len(d.webhookURLs))
+	for i := range d.webhookURLs {
+		webhooks[i] = discordWebhookID(d.webhookURLs[i], i)
+	}
+
+	for i := range d.webhookURLs {
+		logger := logger.With(zap.String("webhook", webhooks[i]))
+		if _, ok := sent[webhooks[i]]; ok {
+			logger.Debug("skipping webhook posted to by a previous attempt")
+			continue
+		}
+
+		id, err := d.execute(ctx, logger, d.webhookURLs[i], msg, media)
+		if err != nil {
+			const msg = "unable to execute webhook"
+			logger.Error(msg, zap.Error(err))
+			if len(sent) > 0 {
+				// the message was posted to the webhooks sent to
+				return joinSentIDs(webhooks, sent), fmt.Errorf(msg+" %s: %v", webhooks[i], err)
+			}
+			return "", fmt.Errorf(msg+" %s: %w", webhooks[i], err)
+		}
+		sent[webhooks[i]] = id
+	}
+
+	return joinSentIDs(webhooks, sent), nil
+}
+
+// discordWebhookID returns the ID of the webhook, which unlike its URL isn't
+// a secret. The position of the webhook is returned for URLs that aren't of
+// the form .../webhooks/{id}/{token}.
+func discordWebhookID(webhookURL string, i int) string {
+	if u, err := url.Parse(webhookURL); err == nil {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for j := 0; j+1 < len(parts); j++ {
+			if parts[j] == "webhooks" && parts[j+1] != "" {
+				return parts[j+1]
+			}
+		}
+	}
+
+	return strconv.Itoa(i)
+}
+
+func (d *Discord) saleEmbed(rec sales.Record, description string, media *Media) discordEmbed {
+	embed := discordEmbed{
+		Title:       rec.NFT.Name,
+		Description: description,
+		URL:         solscanURL + "/tx/" + rec.ID,
+		Color:       discordEmbedColor,
+	}
+
+	if price := sales.ToSolPriceStr(rec.Price); price != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Price", Value: price + " SOL", Inline: true})
+	}
+
+	if rec.Marketplace != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Marketplace", Value: rec.Marketplace, Inline: true})
+	}
+
+	if rec.Buyer != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Buyer", Value: solscanAccountLink(rec.Buyer)})
+	}
+
+	if rec.Seller != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Seller", Value: solscanAccountLink(rec.Seller)})
+	}
+
+	embed.Fields = append(embed.Fields, discordField{
+		Name:  "Transaction",
+		Value: "[View on Solscan](" + solscanURL + "/tx/" + rec.ID + ")",
+	})
+
+	if rec.SaleTime != nil {
+		embed.Timestamp = rec.SaleTime.UTC().Format(time.RFC3339)
+	}
+
+	if media != nil {
+		embed.Thumbnail = &discordImage{URL: "attachment://" + mediaFilename(media)}
+	}
+
+	return embed
+}
+
+// execute executes the webhook, waiting for the message to be created so that
+// its ID can be returned. Rate limited requests are retried after the
+// retry_after communicated by Discord.
+func (d *Discord) execute(
+	ctx context.Context,
+	logger *zap.Logger,
+	webhookURL string,
+	msg discordMessage,
+	media *Media) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		// the error contains the url which contains the webhook token
+		const msg = "unable to parse webhook url"
+		logger.Error(msg, zap.Error(withoutURL(err)))
+		return "", notPosted(fmt.Errorf(msg+": %w", withoutURL(err)))
+	}
+	q := u.Query()
+	q.Set("wait", "true")
+	u.RawQuery = q.Encode()
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		const msg = "unable to marshal discord message"
+		logger.Error(msg, zap.Error(err))
+		return "", notPosted(fmt.Errorf(msg+": %w", err))
+	}
+
+	for retry := 0; ; retry++ {
+		body, contentType, err := discordBody(payload, media)
+		if err != nil {
+			const msg = "unable to create webhook body"
+			logger.Error(msg, zap.Error(err))
+			return "", notPosted(fmt.Errorf(msg+": %w", err))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+		if err != nil {
+			const msg = "unable to create webhook request"
+			logger.Error(msg, zap.Error(err))
+			return "", notPosted(fmt.Errorf(msg+": %w", err))
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			// the error contains the url which contains the webhook token
+			const msg = "unable to execute webhook"
+			logger.Error(msg, zap.Error(withoutURL(err)))
+			return "", fmt.Errorf(msg+": %w", withoutURL(err))
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			const msg = "unable to read webhook response"
+			logger.Error(msg, zap.Error(err))
+			return "", fmt.Errorf(msg+": %w", err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			if retry >= maxDiscordRetries {
+				const msg = "exceeded discord rate limit retries"
+				logger.Error(msg, zap.Int("retries", retry))
+				return "", notPosted(fmt.Errorf(msg+": %d", retry))
+			}
+
+			wait := discordRetryAfter(resp.Header, respBody)
+			logger.Warn("rate limited by discord, retrying", zap.Duration("retryAfter", wait))
+			select {
+			case <-ctx.Done():
+				return "", notPosted(ctx.Err())
+			case <-time.After(wait):
+			}
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			const msg = "received non-200 response from discord"
+			logger.Error(msg, zap.Int("status", resp.StatusCode), zap.String("body", string(respBody)))
+			return "", refused(resp.StatusCode, fmt.Errorf(msg+": %d", resp.StatusCode))
+		}
+
+		var m struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(respBody, &m); err != nil {
+			const msg = "unable to decode webhook response"
+			logger.Error(msg, zap.Error(err))
+			return "", fmt.Errorf(msg+": %w", err)
+		}
+
+		return m.ID, nil
+	}
+}
+
+// discordBody creates the webhook request body. When there is media the body
+// is multipart so the media can be attached and referenced by the embed.
+func discordBody(payload []byte, media *Media) (*bytes.Buffer, string, error) {
+	if media == nil {
+		return bytes.NewBuffer(payload), "application/json", nil
+	}
+
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	if err := w.WriteField("payload_json", string(payload)); err != nil {
+		return nil, "", fmt.Errorf("unable to write payload field: %w", err)
+	}
+
+	part, err := w.CreateFormFile("files[0]", mediaFilename(media))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create form file: %w", err)
+	}
+	if _, err := part.Write(media.Data); err != nil {
+		return nil, "", fmt.Errorf("unable to write media: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("unable to close multipart writer: %w", err)
+	}
+
+	return buf, w.FormDataContentType(), nil
+}
+
+// discordRetryAfter returns how long to wait before retrying a rate limited
+// request. The body's retry_after is preferred as it has sub-second precision,
+// falling back to the Retry-After header.
+func discordRetryAfter(header http.Header, body []byte) time.Duration {
+	var rl struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &rl); err == nil && rl.RetryAfter > 0 {
+		return time.Duration(rl.RetryAfter * float64(time.Second))
+	}
+
+	if secs, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+
+	return time.Second
+}
+
+func solscanAccountLink(address string) string {
+	return "[" + posts.ShortenAddress(address) + "](" + solscanURL + "/account/" + address + ")"
+}
+
+func mediaFilename(media *Media) string {
+	ext := media.Ext
+	if ext == "" {
+		ext = "png"
+	}
+
+	return "nft." + ext
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Thumbnail   *discordImage  `json:"thumbnail,omitempty"`
+	Image       *discordImage  `json:"image,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordImage struct {
+	URL string `json:"url"`
+}
@@ -0,0 +1,117 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales/posts"
+)
+
+func TestDiscordRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		body   string
+		wait   time.Duration
+	}{
+		{
+			name: "body",
+			body: `{"message":"You are being rate limited.","retry_after":0.5,"global":false}`,
+			wait: 500 * time.Millisecond,
+		},
+		{
+			// the body is more precise than the header
+			name:   "body and header",
+			header: http.Header{"Retry-After": {"1"}},
+			body:   `{"retry_after":0.25}`,
+			wait:   250 * time.Millisecond,
+		},
+		{
+			name:   "header",
+			header: http.Header{"Retry-After": {"2"}},
+			body:   `<html>rate limited</html>`,
+			wait:   2 * time.Second,
+		},
+		{
+			name: "neither",
+			body: `{}`,
+			wait: time.Second,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.wait, discordRetryAfter(tc.header, []byte(tc.body)))
+		})
+	}
+}
+
+func TestDiscordPostRateLimited(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		rateLimited int
+		calls       int
+		id          string
+	}{
+		{
+			name:        "retried",
+			rateLimited: 2,
+			calls:       3,
+			id:          "123:42",
+		},
+		{
+			name:        "retries exhausted",
+			rateLimited: maxDiscordRetries + 1,
+			calls:       maxDiscordRetries + 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				calls int
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/webhooks/123/token", r.URL.Path)
+				assert.Equal(t, "true", r.URL.Query().Get("wait"))
+
+				mu.Lock()
+				calls++
+				rateLimited := calls <= tc.rateLimited
+				mu.Unlock()
+
+				if rateLimited {
+					w.WriteHeader(http.StatusTooManyRequests)
+					_, _ = w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.001,"global":false}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"id":"42"}`))
+			}))
+			defer srv.Close()
+
+			templates, err := posts.NewTemplates(zap.NewNop(), posts.Config{})
+			require.NoError(t, err)
+			d, err := NewDiscord(zap.NewNop(), templates, []string{srv.URL + "/api/webhooks/123/token"})
+			require.NoError(t, err)
+
+			id, err := d.Post(context.Background(), Post{Title: "Daily Recap", Text: "recap"})
+			if tc.id == "" {
+				require.Error(t, err)
+				require.True(t, errors.Is(err, ErrNotPosted))
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.id, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, tc.calls, calls)
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+const (
+	// mastodonMediaPollInterval is how often the media is checked while the
+	// instance processes it asynchronously
+	mastodonMediaPollInterval = time.Second
+
+	// mastodonMediaTimeout is how long the media can be processed for before
+	// giving up on the status
+	mastodonMediaTimeout = time.Minute
+)
+
+// Mastodon publishes sales as statuses on a Mastodon instance
+type Mastodon struct {
+	accessToken string
+	client      *http.Client
+	instanceURL string
+	logger      *zap.Logger
+	templates   *posts.Templates
+}
+
+// MastodonConfig is the configuration of the Mastodon publisher
+type MastodonConfig struct {
+	// InstanceURL is the base URL of the instance e.g. https://mastodon.social
+	InstanceURL string
+
+	// AccessToken is the token of the account the sales are posted from. It
+	// requires the write:media and write:statuses scopes.
+	AccessToken string
+}
+
+func NewMastodon(logger *zap.Logger, templates *posts.Templates, cfg MastodonConfig) (*Mastodon, error) {
+	m := Mastodon{
+		accessToken: cfg.AccessToken,
+		client:      &http.Client{Timeout: time.Second * 30},
+		instanceURL: strings.TrimSuffix(cfg.InstanceURL, "/"),
+		logger:      logger,
+		templates:   templates,
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (m *Mastodon) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return m.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return m.templates != nil },
+		},
+		{
+			dep: "instanceURL",
+			chk: func() bool { return m.instanceURL != "" },
+		},
+		{
+			dep: "accessToken",
+			chk: func() bool { return m.accessToken != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize mastodon publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the mastodon publish channel
+func (m *Mastodon) Channel() sales.PublishChannel { return sales.Mastodon }
+
+// Publish uploads the media, if given, and posts the sale status, keyed by the
+// sale ID. The status ID is returned.
+func (m *Mastodon) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := m.logger.With(zap.String("saleId", record.ID))
+
+	text, err := m.templates.Render(ctx, sales.Mastodon, record)
+	if err != nil {
+		const msg = "unable to render status"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return m.post(ctx, logger, text, media, mastodonAltText(record), record.ID)
+}
+
+// Post uploads the media, if given, and posts the text as a status, keyed by
+// the post's key. The status ID is returned.
+func (m *Mastodon) Post(ctx context.Context, post Post) (string, error) {
+	return m.post(ctx, m.logger, post.Text, post.Media, post.AltText, post.Key)
+}
+
+// Verify looks up the account the access token belongs to
+func (m *Mastodon) Verify(ctx context.Context) error {
+	var account struct {
+		ID string `json:"id"`
+	}
+	if _, err := m.do(ctx, http.MethodGet, "/api/v1/accounts/verify_credentials", nil, nil, &account); err != nil {
+		const msg = "unable to verify mastodon access token"
+		m.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	return nil
+}
+
+func (m *Mastodon) post(
+	ctx context.Context,
+	logger *zap.Logger,
+	text string,
+	media *Media,
+	altText string,
+	idempotencyKey string) (string, error) {
+	var mediaIDs []string
+	if media != nil {
+		mediaID, err := m.uploadMedia(ctx, logger, media, altText)
+		if err != nil {
+			const msg = "unable to upload media to mastodon"
+			logger.Error(msg, zap.Error(err))
+			return "", notPosted(fmt.Errorf(msg+": %w", err))
+		}
+		mediaIDs = append(mediaIDs, mediaID)
+	}
+
+	id, err := m.postStatus(ctx, logger, text, mediaIDs, idempotencyKey)
+	if err != nil {
+		const msg = "unable to post mastodon status"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return id, nil
+}
+
+// uploadMedia uploads the media with the v2 media API. Large media is
+// processed asynchronously, in which case the media is polled until it has
+// finished processing as it can't be attached to a status before then.
+func (m *Mastodon) uploadMedia(ctx context.Context, logger *zap.Logger, media *Media, altText string) (string, error) {
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	part, err := w.CreateFormFile("file", mediaFilename(media))
+	if err != nil {
+		const msg = "unable to create form file"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	if _, err := part.Write(media.Data); err != nil {
+		const msg = "unable to write media"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	if err := w.WriteField("description", altText); err != nil {
+		const msg = "unable to write description field"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	if err := w.Close(); err != nil {
+		const msg = "unable to close multipart writer"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	var attachment mastodonAttachment
+	header := http.Header{"Content-Type": {w.FormDataContentType()}}
+	status, err := m.do(ctx, http.MethodPost, "/api/v2/media", header, buf, &attachment)
+	if err != nil {
+		const msg = "unable to upload media"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	logger = logger.With(zap.String("mediaId", attachment.ID))
+
+	// 200 means the media was processed synchronously
+	if status == http.StatusOK && attachment.URL != "" {
+		return attachment.ID, nil
+	}
+
+	logger.Debug("media is processing, polling until processed")
+	timeout := time.NewTimer(mastodonMediaTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(mastodonMediaPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout.C:
+			const msg = "timed out waiting for media to process"
+			logger.Error(msg)
+			return "", fmt.Errorf(msg+": %s", mastodonMediaTimeout)
+		case <-ticker.C:
+		}
+
+		// 206 communicates the media is still processing
+		status, err := m.do(ctx, http.MethodGet, "/api/v1/media/"+attachment.ID, nil, nil, &attachment)
+		if err != nil {
+			const msg = "unable to get media"
+			logger.Error(msg, zap.Error(err))
+			return "", fmt.Errorf(msg+": %w", err)
+		}
+		if status == http.StatusOK && attachment.URL != "" {
+			return attachment.ID, nil
+		}
+	}
+}
+
+// postStatus posts the status. The instance returns the status posted with the
+// same idempotency key within the last hour instead of posting it again, so a
+// status that may have been posted can be retried.
+func (m *Mastodon) postStatus(
+	ctx context.Context,
+	logger *zap.Logger,
+	text string,
+	mediaIDs []string,
+	idempotencyKey string) (string, error) {
+	body, err := json.Marshal(mastodonStatus{
+		Status:   text,
+		MediaIDs: mediaIDs,
+	})
+	if err != nil {
+		const msg = "unable to marshal status"
+		logger.Error(msg, zap.Error(err))
+		return "", notPosted(fmt.Errorf(msg+": %w", err))
+	}
+
+	var status struct {
+		ID string `json:"id"`
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if idempotencyKey != "" {
+		header.Set("Idempotency-Key", idempotencyKey)
+	}
+	if _, err := m.do(ctx, http.MethodPost, "/api/v1/statuses", header, bytes.NewReader(body), &status); err != nil {
+		const msg = "unable to create status"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return status.ID, nil
+}
+
+// do performs an authenticated request with the headers against the instance,
+// decoding the response into out. The response status code is returned.
+func (m *Mastodon) do(
+	ctx context.Context,
+	method string,
+	path string,
+	header http.Header,
+	body io.Reader,
+	out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, m.instanceURL+path, body)
+	if err != nil {
+		return 0, notPosted(fmt.Errorf("unable to create request: %w", err))
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to perform request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(b, &e)
+		return resp.StatusCode, refused(resp.StatusCode, fmt.Errorf("received non-200 response from mastodon: %d %s", resp.StatusCode, e.Error))
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func mastodonAltText(rec sales.Record) string {
+	alt := "Image of the " + rec.NFT.Name + " NFT"
+	if price := sales.ToSolPriceStr(rec.Price); price != "" {
+		alt += ", sold for " + price + " SOL"
+	}
+	if rec.Marketplace != "" {
+		alt += " on " + rec.Marketplace
+	}
+
+	return alt
+}
+
+type mastodonAttachment struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+type mastodonStatus struct {
+	Status   string   `json:"status"`
+	MediaIDs []string `json:"media_ids,omitempty"`
+}
@@ -0,0 +1,61 @@
+package publisher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+func TestMastodonIdempotencyKey(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		publish func(ctx context.Context, m *Mastodon) (string, error)
+		key     string
+	}{
+		{
+			name: "sale",
+			publish: func(ctx context.Context, m *Mastodon) (string, error) {
+				return m.Publish(ctx, sales.Record{ID: "5xSig", NFT: sales.NFT{Name: "Bromato #12"}}, nil)
+			},
+			key: "5xSig",
+		},
+		{
+			name: "post",
+			publish: func(ctx context.Context, m *Mastodon) (string, error) {
+				return m.Post(ctx, Post{Text: "recap", Key: "recap::daily"})
+			},
+			key: "recap::daily",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v1/statuses", r.URL.Path)
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.Equal(t, tc.key, r.Header.Get("Idempotency-Key"))
+				_, _ = w.Write([]byte(`{"id":"42"}`))
+			}))
+			defer srv.Close()
+
+			templates, err := posts.NewTemplates(zap.NewNop(), posts.Config{})
+			require.NoError(t, err)
+			m, err := NewMastodon(zap.NewNop(), templates, MastodonConfig{
+				InstanceURL: srv.URL,
+				AccessToken: "token",
+			})
+			require.NoError(t, err)
+
+			id, err := tc.publish(context.Background(), m)
+			require.NoError(t, err)
+			require.Equal(t, "42", id)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	solscanURL = "https://solscan.io"
+)
+
+// Publisher is responsible for posting a sale to a single publish channel
+// e.g. twitter. The service fans a sale out to every configured publisher.
+type Publisher interface {
+	// Channel returns the publish channel the publisher posts to
+	Channel() sales.PublishChannel
+
+	// Publish posts the sales record, along with its media if given, to the
+	// channel and returns the external ID of the post. Publishers posting to
+	// several destinations return, along with the error, the external ID of
+	// the destinations that were posted to. It is recorded on the record's
+	// publish state so that the retry skips them.
+	Publish(ctx context.Context, record sales.Record, media *Media) (string, error)
+}
+
+// Poster is implemented by the publishers that can post text other than a
+// sale, e.g. recaps. The webhook publisher only delivers sale events and
+// doesn't implement it.
+type Poster interface {
+	// Channel returns the publish channel the poster posts to
+	Channel() sales.PublishChannel
+
+	// Post posts the text, along with its media if given, to the channel and
+	// returns the external ID of the post. Errors of posts known not to have
+	// been made match ErrNotPosted.
+	Post(ctx context.Context, post Post) (string, error)
+}
+
+// ErrNotPosted is matched by the errors of posts known not to have been made,
+// as they failed before being sent or were refused by the channel. Any other
+// error leaves it unknown whether the post was made e.g. a timeout waiting
+// for the response.
+var ErrNotPosted = errors.New("post not made")
+
+// notPostedError marks the error of a post known not to have been made
+type notPostedError struct {
+	err error
+}
+
+func notPosted(err error) error {
+	return notPostedError{err: err}
+}
+
+func (e notPostedError) Error() string { return e.err.Error() }
+
+func (e notPostedError) Unwrap() error { return e.err }
+
+func (e notPostedError) Is(target error) bool { return target == ErrNotPosted }
+
+// refused returns the error of a non-2xx response, marked as not posted when
+// the channel refused the request. After a 5xx the post may have been made.
+func refused(statusCode int, err error) error {
+	if statusCode < 500 {
+		return notPosted(err)
+	}
+
+	return err
+}
+
+// Verifier is implemented by the publishers whose credentials can be checked
+// without posting. Slack and webhook endpoints can only be checked by posting
+// to them and don't implement it.
+type Verifier interface {
+	// Channel returns the publish channel the verifier posts to
+	Channel() sales.PublishChannel
+
+	// Verify returns an error when the credentials are rejected, or can't be
+	// checked
+	Verify(ctx context.Context) error
+}
+
+// Post is a post that isn't a sale, its text is rendered for the channel
+type Post struct {
+	// Title is the title shown by the channels that display one e.g. in
+	// discord embeds
+	Title string
+
+	// Text is the text of the post
+	Text string
+
+	// Collection is the collection the post is about, used by the channels
+	// that route collections to their own destination
+	Collection sales.NFTCollection
+
+	// Media is the media attached to the post, optional
+	Media *Media
+
+	// AltText describes the media
+	AltText string
+
+	// Key uniquely identifies the post, the channels that support it send it
+	// so that a retried post isn't posted twice
+	Key string
+}
+
+// sentIDs returns the IDs of the posts sent by the previous attempts to
+// publish the record to the channel, by destination. The external ID of the
+// attempts is the comma separated list of destination:postID pairs.
+func sentIDs(record sales.Record, channel sales.PublishChannel) map[string]string {
+	sent := make(map[string]string)
+
+	state := record.Publishes[channel]
+	if state == nil || state.ExternalID == "" {
+		return sent
+	}
+
+	for _, pair := range strings.Split(state.ExternalID, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			sent[parts[0]] = parts[1]
+		}
+	}
+
+	return sent
+}
+
+// joinSentIDs returns the external ID of the posts sent to the destinations,
+// in the order of the destinations
+func joinSentIDs(destinations []string, sent map[string]string) string {
+	pairs := make([]string, 0, len(sent))
+	for _, d := range destinations {
+		if id, ok := sent[d]; ok {
+			pairs = append(pairs, d+":"+id)
+		}
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// withoutURL returns the error of an HTTP request without the request's URL,
+// which may carry credentials e.g. the token of a discord webhook
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
+// Media represents the NFT media that is attached to a published sale
+type Media struct {
+	// Data is the raw bytes of the media
+	Data []byte
+
+	// ContentType is the MIME type of the media e.g. image/png
+	ContentType string
+
+	// Ext is the file extension of the media e.g. png
+	Ext string
+
+	// URI is the location the media was downloaded from
+	URI string
+
+	// Animation is the NFT's animation e.g. an mp4 or gif, if it has one.
+	// Channels that support animations attach it instead of the image.
+	Animation *Media
+}
+
+// mediaExts are the extensions of the supported media types
+var mediaExts = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+	"video/mp4":  "mp4",
+	"video/webm": "webm",
+}
+
+// MediaExt returns the file extension of the supported media type, empty for
+// unsupported types
+func MediaExt(contentType string) string {
+	return mediaExts[contentType]
+}
+
+// IsVideo returns whether the media is a video
+func (m *Media) IsVideo() bool {
+	return strings.HasPrefix(m.ContentType, "video/")
+}
@@ -0,0 +1,274 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+// Slack publishes sales as Block Kit messages through Slack incoming webhooks.
+// Sales are routed to a webhook by their collection, falling back to the
+// default webhook.
+type Slack struct {
+	client             *http.Client
+	collectionWebhooks map[sales.NFTCollection]string
+	defaultWebhookURL  string
+	logger             *zap.Logger
+	templates          *posts.Templates
+}
+
+// SlackConfig is the configuration of the Slack publisher
+type SlackConfig struct {
+	// DefaultWebhookURL is the webhook used for collections that do not have
+	// their own webhook
+	DefaultWebhookURL string
+
+	// CollectionWebhooks routes the sales of a collection to its own webhook
+	CollectionWebhooks map[sales.NFTCollection]string
+}
+
+func NewSlack(logger *zap.Logger, templates *posts.Templates, cfg SlackConfig) (*Slack, error) {
+	s := Slack{
+		client:             &http.Client{Timeout: time.Second * 30},
+		collectionWebhooks: cfg.CollectionWebhooks,
+		defaultWebhookURL:  cfg.DefaultWebhookURL,
+		logger:             logger,
+		templates:          templates,
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Slack) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return s.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return s.templates != nil },
+		},
+		{
+			dep: "webhookURL",
+			chk: func() bool { return s.defaultWebhookURL != "" || len(s.collectionWebhooks) > 0 },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize slack publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the slack publish channel
+func (s *Slack) Channel() sales.PublishChannel { return sales.Slack }
+
+// Publish posts the sale to the collection's webhook. Incoming webhooks do not
+// return the ID of the posted message so an empty ID is returned on success.
+// Nor can they upload files, the message shows the NFT's original image
+// rather than the sale card.
+func (s *Slack) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := s.logger.With(zap.String("saleId", record.ID), zap.String("collection", string(record.Collection)))
+
+	text, err := s.templates.Render(ctx, sales.Slack, record)
+	if err != nil {
+		const msg = "unable to render slack message"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return s.post(ctx, logger, record.Collection, slackSaleMessage(record, text, media))
+}
+
+// Post posts the text to the collection's webhook, with the media when it has
+// a public URL. An empty ID is returned on success.
+func (s *Slack) Post(ctx context.Context, post Post) (string, error) {
+	logger := s.logger.With(zap.String("collection", string(post.Collection)))
+
+	var blocks []slackBlock
+	if post.Title != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "header",
+			Text: &slackText{Type: "plain_text", Text: post.Title},
+		})
+	}
+	blocks = append(blocks, slackBlock{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: post.Text},
+	})
+	if m := post.Media; m != nil && (strings.HasPrefix(m.URI, "https://") || strings.HasPrefix(m.URI, "http://")) {
+		blocks = append(blocks, slackBlock{
+			Type:     "image",
+			ImageURL: m.URI,
+			AltText:  post.AltText,
+		})
+	}
+
+	return s.post(ctx, logger, post.Collection, slackMessage{Text: post.Text, Blocks: blocks})
+}
+
+func (s *Slack) post(ctx context.Context, logger *zap.Logger, collection sales.NFTCollection, msg slackMessage) (string, error) {
+	webhookURL, ok := s.collectionWebhooks[collection]
+	if !ok {
+		webhookURL = s.defaultWebhookURL
+	}
+	if webhookURL == "" {
+		const msg = "no slack webhook configured for collection"
+		logger.Error(msg)
+		return "", notPosted(fmt.Errorf(msg+": %s", collection))
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		const msg = "unable to marshal slack message"
+		logger.Error(msg, zap.Error(err))
+		return "", notPosted(fmt.Errorf(msg+": %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		const msg = "unable to create webhook request"
+		logger.Error(msg, zap.Error(err))
+		return "", notPosted(fmt.Errorf(msg+": %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		const msg = "unable to post slack message"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		const msg = "received non-200 response from slack"
+		logger.Error(msg, zap.Int("status", resp.StatusCode), zap.String("body", string(b)))
+		return "", refused(resp.StatusCode, fmt.Errorf(msg+": %d", resp.StatusCode))
+	}
+
+	return "", nil
+}
+
+func slackSaleMessage(rec sales.Record, text string, media *Media) slackMessage {
+	txURL := solscanURL + "/tx/" + rec.ID
+
+	blocks := []slackBlock{
+		{
+			Type: "header",
+			Text: &slackText{Type: "plain_text", Text: rec.NFT.Name},
+		},
+		{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: text},
+		},
+	}
+
+	// image blocks require a publicly reachable url, which the processed
+	// media such as the sale card doesn't have, the image it was made from is
+	// shown instead
+	if media != nil && (strings.HasPrefix(media.URI, "https://") || strings.HasPrefix(media.URI, "http://")) {
+		blocks = append(blocks, slackBlock{
+			Type:     "image",
+			ImageURL: media.URI,
+			AltText:  rec.NFT.Name,
+		})
+	}
+
+	var fields []slackText
+	if price := sales.ToSolPriceStr(rec.Price); price != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Price*\n" + price + " SOL"})
+	}
+	if rec.Marketplace != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Marketplace*\n" + rec.Marketplace})
+	}
+	if rec.SaleTime != nil {
+		fields = append(fields, slackText{
+			Type: "mrkdwn",
+			// render the time in the reader's timezone, falling back to UTC
+			Text: fmt.Sprintf(
+				"*Sale Time*\n<!date^%d^{date_short_pretty} {time}|%s>",
+				rec.SaleTime.Unix(),
+				rec.SaleTime.UTC().Format(time.RFC1123),
+			),
+		})
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, slackBlock{
+			Type:   "section",
+			Fields: fields,
+		})
+	}
+
+	blocks = append(blocks, slackBlock{
+		Type: "actions",
+		Elements: []slackElement{
+			{
+				Type: "button",
+				Text: slackText{Type: "plain_text", Text: "View Transaction"},
+				URL:  txURL,
+			},
+		},
+	})
+
+	return slackMessage{
+		Text:   text,
+		Blocks: blocks,
+	}
+}
+
+type slackMessage struct {
+	// Text is the fallback used by notifications
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text,omitempty"`
+	Fields   []slackText    `json:"fields,omitempty"`
+	ImageURL string         `json:"image_url,omitempty"`
+	AltText  string         `json:"alt_text,omitempty"`
+	Elements []slackElement `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackElement struct {
+	Type string    `json:"type"`
+	Text slackText `json:"text"`
+	URL  string    `json:"url,omitempty"`
+}
@@ -0,0 +1,340 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+const (
+	// TelegramAPIURL is the base URL of the Telegram Bot API
+	TelegramAPIURL = "https://api.telegram.org"
+
+	// maxTelegramRetries is the number of times a request is retried after
+	// being rate limited by Telegram
+	maxTelegramRetries = 3
+)
+
+// Telegram publishes sales to one or more Telegram chats using the Bot API
+type Telegram struct {
+	baseURL   string
+	chatIDs   []string
+	client    *http.Client
+	logger    *zap.Logger
+	templates *posts.Templates
+	token     string
+}
+
+// TelegramConfig is the configuration of the Telegram publisher
+type TelegramConfig struct {
+	// BaseURL is the base URL of the Bot API, defaults to TelegramAPIURL. This
+	// can be pointed at a local fake Bot API server.
+	BaseURL string
+
+	// BotToken is the token of the bot that posts the sales
+	BotToken string
+
+	// ChatIDs are the chats, or @channel usernames, the sales are sent to
+	ChatIDs []string
+}
+
+func NewTelegram(logger *zap.Logger, templates *posts.Templates, cfg TelegramConfig) (*Telegram, error) {
+	t := Telegram{
+		baseURL:   strings.TrimSuffix(cfg.BaseURL, "/"),
+		chatIDs:   cfg.ChatIDs,
+		client:    &http.Client{Timeout: time.Second * 30},
+		logger:    logger,
+		templates: templates,
+		token:     cfg.BotToken,
+	}
+	if t.baseURL == "" {
+		t.baseURL = TelegramAPIURL
+	}
+
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (t *Telegram) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return t.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return t.templates != nil },
+		},
+		{
+			dep: "botToken",
+			chk: func() bool { return t.token != "" },
+		},
+		{
+			dep: "chatIDs",
+			chk: func() bool { return len(t.chatIDs) > 0 },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize telegram publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the telegram publish channel
+func (t *Telegram) Channel() sales.PublishChannel { return sales.Telegram }
+
+// Publish sends the sale to every chat, as a photo with a caption when there
+// is media, but the chats sent to by a previous attempt. The returned ID is
+// the comma separated list of chatID:messageID pairs.
+func (t *Telegram) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := t.logger.With(zap.String("saleId", record.ID))
+
+	// templates are responsible for the MarkdownV2 escaping
+	caption, err := t.templates.Render(ctx, sales.Telegram, record)
+	if err != nil {
+		const msg = "unable to render caption"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return t.send(ctx, logger, sentIDs(record, sales.Telegram), caption, media)
+}
+
+// Post sends the text to every chat, as a photo caption when there is media.
+// The text must be escaped for MarkdownV2. The returned ID is the comma
+// separated list of chatID:messageID pairs.
+func (t *Telegram) Post(ctx context.Context, post Post) (string, error) {
+	return t.send(ctx, t.logger, make(map[string]string), post.Text, post.Media)
+}
+
+// Verify looks up the bot the token belongs to
+func (t *Telegram) Verify(ctx context.Context) error {
+	_, err := t.call(ctx, t.logger, "getMe", func() (*bytes.Buffer, string, error) {
+		return bytes.NewBufferString("{}"), "application/json", nil
+	})
+	if err != nil {
+		const msg = "unable to verify telegram bot token"
+		t.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	return nil
+}
+
+// send sends the caption to every chat but those in sent, the message IDs by
+// chat ID of a previous attempt. When a chat fails the chats are still sent
+// to, and the ID of the messages sent is returned along with the error. The
+// error matches ErrNotPosted only when no chat may have been sent to.
+func (t *Telegram) send(
+	ctx context.Context,
+	logger *zap.Logger,
+	sent map[string]string,
+	caption string,
+	media *Media) (string, error) {
+	var (
+		failed  []string
+		unknown bool
+	)
+	for _, chatID := range t.chatIDs {
+		logger := logger.With(zap.String("chatId", chatID))
+		if _, ok := sent[chatID]; ok {
+			logger.Debug("skipping chat sent to by a previous attempt")
+			continue
+		}
+
+		var (
+			messageID int64
+			err       error
+		)
+		if media != nil {
+			messageID, err = t.sendPhoto(ctx, logger, chatID, caption, media)
+		} else {
+			messageID, err = t.sendMessage(ctx, logger, chatID, caption)
+		}
+		if err != nil {
+			logger.Error("unable to send telegram message", zap.Error(err))
+			failed = append(failed, chatID)
+			unknown = unknown || !errors.Is(err, ErrNotPosted)
+			continue
+		}
+
+		sent[chatID] = strconv.FormatInt(messageID, 10)
+	}
+
+	if len(failed) > 0 {
+		const msg = "unable to send telegram message"
+		err := fmt.Errorf(msg+" to (%d) chats: %s", len(failed), strings.Join(failed, ","))
+		if len(sent) == 0 && !unknown {
+			err = notPosted(err)
+		}
+		return joinSentIDs(t.chatIDs, sent), err
+	}
+
+	return joinSentIDs(t.chatIDs, sent), nil
+}
+
+func (t *Telegram) sendPhoto(
+	ctx context.Context,
+	logger *zap.Logger,
+	chatID string,
+	caption string,
+	media *Media) (int64, error) {
+	return t.call(ctx, logger, "sendPhoto", func() (*bytes.Buffer, string, error) {
+		buf := new(bytes.Buffer)
+		w := multipart.NewWriter(buf)
+		for _, f := range [][2]string{
+			{"chat_id", chatID},
+			{"caption", caption},
+			{"parse_mode", "MarkdownV2"},
+		} {
+			if err := w.WriteField(f[0], f[1]); err != nil {
+				return nil, "", fmt.Errorf("unable to write %s field: %w", f[0], err)
+			}
+		}
+
+		part, err := w.CreateFormFile("photo", mediaFilename(media))
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to create form file: %w", err)
+		}
+		if _, err := part.Write(media.Data); err != nil {
+			return nil, "", fmt.Errorf("unable to write media: %w", err)
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, "", fmt.Errorf("unable to close multipart writer: %w", err)
+		}
+
+		return buf, w.FormDataContentType(), nil
+	})
+}
+
+func (t *Telegram) sendMessage(ctx context.Context, logger *zap.Logger, chatID string, text string) (int64, error) {
+	return t.call(ctx, logger, "sendMessage", func() (*bytes.Buffer, string, error) {
+		b, err := json.Marshal(map[string]string{
+			"chat_id":    chatID,
+			"text":       text,
+			"parse_mode": "MarkdownV2",
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to marshal message: %w", err)
+		}
+
+		return bytes.NewBuffer(b), "application/json", nil
+	})
+}
+
+// call calls the Bot API method and returns the ID of the sent message. The
+// body is rebuilt on every attempt as requests rate limited by Telegram are
+// retried after the communicated retry_after.
+func (t *Telegram) call(
+	ctx context.Context,
+	logger *zap.Logger,
+	method string,
+	body func() (*bytes.Buffer, string, error)) (int64, error) {
+	logger = logger.With(zap.String("method", method))
+
+	for retry := 0; ; retry++ {
+		buf, contentType, err := body()
+		if err != nil {
+			const msg = "unable to create request body"
+			logger.Error(msg, zap.Error(err))
+			return 0, notPosted(fmt.Errorf(msg+": %w", err))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/bot"+t.token+"/"+method, buf)
+		if err != nil {
+			const msg = "unable to create request"
+			logger.Error(msg, zap.Error(err))
+			return 0, notPosted(fmt.Errorf(msg+": %w", err))
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			// the error contains the url which contains the bot token
+			const msg = "unable to call telegram bot api"
+			logger.Error(msg)
+			return 0, fmt.Errorf(msg+": %s", method)
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			const msg = "unable to read response"
+			logger.Error(msg, zap.Error(err))
+			return 0, fmt.Errorf(msg+": %w", err)
+		}
+
+		var r telegramResponse
+		if err := json.Unmarshal(respBody, &r); err != nil {
+			const msg = "unable to decode response"
+			logger.Error(msg, zap.Error(err), zap.Int("status", resp.StatusCode))
+			return 0, fmt.Errorf(msg+": %w", err)
+		}
+
+		if r.OK {
+			return r.Result.MessageID, nil
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && retry < maxTelegramRetries {
+			wait := time.Second
+			if r.Parameters != nil && r.Parameters.RetryAfter > 0 {
+				wait = time.Duration(r.Parameters.RetryAfter) * time.Second
+			}
+			logger.Warn("rate limited by telegram, retrying", zap.Duration("retryAfter", wait))
+			select {
+			case <-ctx.Done():
+				return 0, notPosted(ctx.Err())
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		const msg = "received error from telegram"
+		logger.Error(msg, zap.Int("errorCode", r.ErrorCode), zap.String("description", r.Description))
+		return 0, refused(resp.StatusCode, fmt.Errorf(msg+": %d %s", r.ErrorCode, r.Description))
+	}
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	ErrorCode   int    `json:"error_code"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+	Parameters *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
@@ -0,0 +1,193 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+)
+
+// telegramPhoto is a sendPhoto call received by the fake Bot API server
+type telegramPhoto struct {
+	chatID    string
+	caption   string
+	parseMode string
+	filename  string
+	photo     []byte
+}
+
+// fakeTelegram is a fake Bot API server accepting sendPhoto calls, failing
+// those to the chats in fail
+type fakeTelegram struct {
+	t    *testing.T
+	fail map[string]bool
+
+	mu     sync.Mutex
+	photos []telegramPhoto
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !assert.Equal(f.t, "/bottoken/sendPhoto", r.URL.Path) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	file, header, err := r.FormFile("photo")
+	if !assert.NoError(f.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	assert.NoError(f.t, err)
+
+	p := telegramPhoto{
+		chatID:    r.FormValue("chat_id"),
+		caption:   r.FormValue("caption"),
+		parseMode: r.FormValue("parse_mode"),
+		filename:  header.Filename,
+		photo:     data,
+	}
+
+	f.mu.Lock()
+	f.photos = append(f.photos, p)
+	messageID, fail := 100+len(f.photos), f.fail[p.chatID]
+	f.mu.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error_code":  400,
+			"description": "Bad Request: chat not found",
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     true,
+		"result": map[string]interface{}{"message_id": messageID},
+	})
+}
+
+func (f *fakeTelegram) sent() []telegramPhoto {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]telegramPhoto(nil), f.photos...)
+}
+
+func newTestTelegram(t *testing.T, srv *httptest.Server, chatIDs ...string) *Telegram {
+	t.Helper()
+
+	templates, err := posts.NewTemplates(zap.NewNop(), posts.Config{})
+	require.NoError(t, err)
+
+	tg, err := NewTelegram(zap.NewNop(), templates, TelegramConfig{
+		BaseURL:  srv.URL,
+		BotToken: "token",
+		ChatIDs:  chatIDs,
+	})
+	require.NoError(t, err)
+
+	return tg
+}
+
+func testTelegramSale() sales.Record {
+	return sales.Record{
+		ID:          "5xSig",
+		Marketplace: "Magic Eden",
+		NFT:         sales.NFT{Name: "Bromato #12 (v1.0)_x"},
+		Price:       1500000000,
+	}
+}
+
+func testMedia() *Media {
+	return &Media{
+		Data:        []byte("\x89PNG image"),
+		ContentType: "image/png",
+		Ext:         "png",
+	}
+}
+
+func TestTelegramPublishPhoto(t *testing.T) {
+	fake := &fakeTelegram{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tg := newTestTelegram(t, srv, "-1001", "@bromato")
+
+	id, err := tg.Publish(context.Background(), testTelegramSale(), testMedia())
+	require.NoError(t, err)
+	require.Equal(t, "-1001:101,@bromato:102", id)
+
+	photos := fake.sent()
+	require.Len(t, photos, 2)
+	require.Equal(t, "-1001", photos[0].chatID)
+	require.Equal(t, "@bromato", photos[1].chatID)
+	for _, p := range photos {
+		require.Equal(t, "MarkdownV2", p.parseMode)
+		require.Equal(t, "nft.png", p.filename)
+		require.Equal(t, []byte("\x89PNG image"), p.photo)
+
+		// the values are escaped, the formatting of the template isn't
+		require.Equal(t, "*New Bromato Sale\\!*\n"+
+			"*Name:* Bromato \\#12 \\(v1\\.0\\)\\_x\n"+
+			"*Price:* 1\\.5 SOL\n"+
+			"*Marketplace:* Magic Eden\n"+
+			"[View transaction](https://solscan.io/tx/5xSig)", p.caption)
+	}
+}
+
+func TestTelegramPublishRetriesFailedChats(t *testing.T) {
+	fake := &fakeTelegram{t: t, fail: map[string]bool{"@bromato": true}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tg := newTestTelegram(t, srv, "-1001", "@bromato")
+	rec := testTelegramSale()
+
+	// the chat sent to is kept even though the publish failed
+	id, err := tg.Publish(context.Background(), rec, testMedia())
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrNotPosted))
+	require.Equal(t, "-1001:101", id)
+
+	fake.mu.Lock()
+	fake.fail = nil
+	fake.mu.Unlock()
+
+	rec.Publishes = map[sales.PublishChannel]*sales.PublishState{
+		sales.Telegram: {Status: sales.PublishPending, ExternalID: id},
+	}
+	id, err = tg.Publish(context.Background(), rec, testMedia())
+	require.NoError(t, err)
+	require.Equal(t, "-1001:101,@bromato:103", id)
+
+	photos := fake.sent()
+	require.Len(t, photos, 3)
+	require.Equal(t, "@bromato", photos[2].chatID)
+}
+
+func TestTelegramPostNotPosted(t *testing.T) {
+	fake := &fakeTelegram{t: t, fail: map[string]bool{"-1001": true}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tg := newTestTelegram(t, srv, "-1001")
+
+	id, err := tg.Post(context.Background(), Post{Text: "recap", Media: testMedia()})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrNotPosted))
+	require.Empty(t, id)
+}
@@ -0,0 +1,173 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/posts"
+	"bromato-sales/internal/twitter"
+)
+
+// Twitter publishes sales as tweets with the NFT image attached
+type Twitter struct {
+	client    *twitter.Client
+	logger    *zap.Logger
+	templates *posts.Templates
+}
+
+func NewTwitter(logger *zap.Logger, templates *posts.Templates, client *twitter.Client) (*Twitter, error) {
+	t := Twitter{
+		client:    client,
+		logger:    logger,
+		templates: templates,
+	}
+
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (t *Twitter) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "client",
+			chk: func() bool { return t.client != nil },
+		},
+		{
+			dep: "logger",
+			chk: func() bool { return t.logger != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return t.templates != nil },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize twitter publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the twitter publish channel
+func (t *Twitter) Channel() sales.PublishChannel { return sales.Twitter }
+
+// Publish uploads the media to twitter, if given, and tweets the sale. The
+// tweet ID is returned.
+func (t *Twitter) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := t.logger.With(zap.String("saleId", record.ID))
+
+	text, err := t.templates.Render(ctx, sales.Twitter, record)
+	if err != nil {
+		const msg = "unable to render tweet"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return t.tweet(ctx, logger, text, media)
+}
+
+// Post uploads the media to twitter, if given, and tweets the text. The tweet
+// ID is returned.
+func (t *Twitter) Post(ctx context.Context, post Post) (string, error) {
+	return t.tweet(ctx, t.logger, post.Text, post.Media)
+}
+
+// Verify looks up the user the client acts as
+func (t *Twitter) Verify(ctx context.Context) error {
+	if _, err := t.client.Me(ctx); err != nil {
+		const msg = "unable to verify twitter credentials"
+		t.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	return nil
+}
+
+func (t *Twitter) tweet(ctx context.Context, logger *zap.Logger, text string, media *Media) (string, error) {
+	var mediaIDs []string
+	if media != nil {
+		mediaID, err := t.uploadMedia(ctx, logger, media)
+		if err != nil {
+			const msg = "unable to upload media to twitter"
+			logger.Error(msg, zap.Error(err))
+			return "", notPosted(fmt.Errorf(msg+": %w", err))
+		}
+		mediaIDs = append(mediaIDs, mediaID)
+	}
+
+	id, err := t.client.CreateTweet(ctx, twitter.Tweet{
+		Text:     text,
+		MediaIDs: mediaIDs,
+	})
+	if err != nil {
+		const msg = "unable to publish tweet"
+		logger.Error(msg, zap.Error(err))
+		err = fmt.Errorf(msg+": %w", err)
+		// twitter refused the tweet, or it wasn't sent as the limit is
+		// exhausted. The tweet may have been created despite a 5xx.
+		var apiErr *twitter.APIError
+		if errors.Is(err, twitter.ErrRateLimited) || (errors.As(err, &apiErr) && apiErr.StatusCode < 500) {
+			err = notPosted(err)
+		}
+		return "", err
+	}
+
+	return id, nil
+}
+
+// uploadMedia uploads the sale's animation when it has one, falling back to
+// the image when the animation is rejected, and returns the media ID
+func (t *Twitter) uploadMedia(ctx context.Context, logger *zap.Logger, media *Media) (string, error) {
+	if media.Animation != nil {
+		id, err := t.client.UploadMedia(ctx, twitterUpload(media.Animation))
+		if err == nil {
+			return id, nil
+		}
+		if errors.Is(err, twitter.ErrRateLimited) {
+			return "", err
+		}
+		logger.Warn("unable to upload animation, falling back to image", zap.Error(err))
+	}
+
+	return t.client.UploadMedia(ctx, twitterUpload(media))
+}
+
+// twitterUpload creates the upload of the media in the media category
+// matching its content type
+func twitterUpload(media *Media) twitter.MediaUpload {
+	category := twitter.CategoryTweetImage
+	switch {
+	case media.ContentType == "image/gif":
+		category = twitter.CategoryTweetGIF
+	case media.IsVideo():
+		category = twitter.CategoryTweetVideo
+	}
+
+	return twitter.MediaUpload{
+		Data:      media.Data,
+		MediaType: media.ContentType,
+		Category:  category,
+	}
+}
@@ -0,0 +1,69 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales/posts"
+	"bromato-sales/internal/twitter"
+)
+
+func TestTwitterPostNotPosted(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		status    int
+		notPosted bool
+	}{
+		{
+			name:      "forbidden",
+			status:    http.StatusForbidden,
+			notPosted: true,
+		},
+		{
+			name:      "rate limited",
+			status:    http.StatusTooManyRequests,
+			notPosted: true,
+		},
+		{
+			// the tweet may have been created
+			name:      "server error",
+			status:    http.StatusServiceUnavailable,
+			notPosted: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(`{"title":"error"}`))
+			}))
+			defer srv.Close()
+
+			client, err := twitter.NewClient(zap.NewNop(), twitter.Config{
+				APIURL:    srv.URL,
+				UploadURL: srv.URL,
+				Credentials: twitter.Credentials{
+					ConsumerKey:       "consumerKey",
+					ConsumerSecret:    "consumerSecret",
+					AccessToken:       "accessToken",
+					AccessTokenSecret: "accessTokenSecret",
+				},
+				HTTPClient: srv.Client(),
+			})
+			require.NoError(t, err)
+			templates, err := posts.NewTemplates(zap.NewNop(), posts.Config{})
+			require.NoError(t, err)
+			tw, err := NewTwitter(zap.NewNop(), templates, client)
+			require.NoError(t, err)
+
+			_, err = tw.Post(context.Background(), Post{Text: "recap"})
+			require.Error(t, err)
+			require.Equal(t, tc.notPosted, errors.Is(err, ErrNotPosted))
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/writer"
+)
+
+const (
+	// WebhookEventVersion is the version of the sale event payload. It is
+	// bumped whenever a breaking change is made to the payload.
+	WebhookEventVersion = "1"
+
+	// WebhookSaleCreated is the type of the event sent for a new sale
+	WebhookSaleCreated = "sale.created"
+
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of the request,
+	// of the form v1=<hex>. The signed content is "<timestamp>.<body>".
+	WebhookSignatureHeader = "X-Bromato-Signature"
+
+	// WebhookTimestampHeader carries the unix time the request was signed at.
+	// Receivers should reject requests with a timestamp outside of a small
+	// tolerance, e.g. 5 minutes, to prevent replays.
+	WebhookTimestampHeader = "X-Bromato-Timestamp"
+
+	// WebhookEventIDHeader carries the ID of the event. A sale can be
+	// delivered more than once so receivers should dedupe on the ID.
+	WebhookEventIDHeader = "X-Bromato-Event-Id"
+
+	// maxWebhookAttempts is the number of times a delivery is attempted before
+	// the endpoint is considered failed
+	maxWebhookAttempts = 4
+
+	// webhookBaseBackoff is the wait before the first retry, doubling with
+	// every attempt
+	webhookBaseBackoff = time.Second
+
+	// maxWebhookDeliveries is the number of delivery attempts kept in the log
+	// of the sales record, older attempts are dropped
+	maxWebhookDeliveries = 50
+)
+
+// Webhook publishes sales as signed JSON events to outbound webhook endpoints.
+// The latest delivery attempts are logged on the sales record.
+type Webhook struct {
+	client    *http.Client
+	endpoints []WebhookEndpoint
+	logger    *zap.Logger
+	writer    *writer.Service
+}
+
+// WebhookEndpoint is an endpoint that receives the sale events
+type WebhookEndpoint struct {
+	// URL the events are posted to
+	URL string
+
+	// Secret is the key used to sign the events sent to the endpoint
+	Secret string
+}
+
+// WebhookEvent is the versioned payload posted to the endpoints
+type WebhookEvent struct {
+	Version   string           `json:"version"`
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Data      WebhookSaleEvent `json:"data"`
+}
+
+// WebhookSaleEvent is the sale data of the event
+type WebhookSaleEvent struct {
+	Signature   string              `json:"signature"`
+	Collection  sales.NFTCollection `json:"collection"`
+	Marketplace string              `json:"marketplace"`
+	MintPubkey  string              `json:"mintPubkey"`
+	Price       uint64              `json:"priceLamports"`
+	PriceSOL    string              `json:"priceSol"`
+	Buyer       string              `json:"buyer"`
+	Seller      string              `json:"seller"`
+	SaleTime    *time.Time          `json:"saleTime"`
+	NFT         sales.NFT           `json:"nft"`
+	ImageURI    string              `json:"imageUri,omitempty"`
+}
+
+func NewWebhook(logger *zap.Logger, w *writer.Service, endpoints []WebhookEndpoint) (*Webhook, error) {
+	wh := Webhook{
+		client:    &http.Client{Timeout: time.Second * 10},
+		endpoints: endpoints,
+		logger:    logger,
+		writer:    w,
+	}
+
+	if err := wh.validate(); err != nil {
+		return nil, err
+	}
+
+	return &wh, nil
+}
+
+func (w *Webhook) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return w.logger != nil },
+		},
+		{
+			dep: "writer",
+			chk: func() bool { return w.writer != nil },
+		},
+		{
+			dep: "endpoints",
+			chk: func() bool { return len(w.endpoints) > 0 },
+		},
+		{
+			dep: "secrets",
+			chk: func() bool {
+				for i := range w.endpoints {
+					if w.endpoints[i].Secret == "" {
+						return false
+					}
+				}
+				return true
+			},
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize webhook publisher due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Channel returns the webhook publish channel
+func (w *Webhook) Channel() sales.PublishChannel { return sales.Webhook }
+
+// Publish delivers the sale event to every endpoint but those delivered to by
+// a previous attempt, retrying failed deliveries with exponential backoff.
+// The returned ID is the comma separated list of endpointID:statusCode pairs
+// of the endpoints that accepted the event.
+func (w *Webhook) Publish(ctx context.Context, record sales.Record, media *Media) (string, error) {
+	logger := w.logger.With(zap.String("saleId", record.ID))
+
+	event := WebhookEvent{
+		Version:   WebhookEventVersion,
+		ID:        record.ID + ":" + WebhookSaleCreated,
+		Type:      WebhookSaleCreated,
+		CreatedAt: time.Now().UTC(),
+		Data: WebhookSaleEvent{
+			Signature:   record.ID,
+			Collection:  record.Collection,
+			Marketplace: record.Marketplace,
+			MintPubkey:  record.MintPubkey,
+			Price:       record.Price,
+			PriceSOL:    sales.ToSolPriceStr(record.Price),
+			Buyer:       record.Buyer,
+			Seller:      record.Seller,
+			SaleTime:    record.SaleTime,
+			NFT:         record.NFT,
+		},
+	}
+	if media != nil {
+		event.Data.ImageURI = media.URI
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		const msg = "unable to marshal webhook event"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	sent := sentIDs(record, sales.Webhook)
+	endpoints := make([]string, len(w.endpoints))
+	var (
+		deliveries []interface{}
+		failed     []string
+	)
+	for i := range w.endpoints {
+		endpoints[i] = webhookEndpointID(w.endpoints[i].URL)
+		if _, ok := sent[endpoints[i]]; ok {
+			logger.Debug("skipping endpoint delivered to by a previous attempt", zap.String("endpoint", redactURL(w.endpoints[i].URL)))
+			continue
+		}
+
+		logs, ok := w.deliver(ctx, logger, w.endpoints[i], event.ID, body)
+		for j := range logs {
+			deliveries = append(deliveries, logs[j])
+		}
+		if !ok {
+			failed = append(failed, redactURL(w.endpoints[i].URL))
+			continue
+		}
+		sent[endpoints[i]] = strconv.Itoa(logs[len(logs)-1].StatusCode)
+	}
+
+	// the log is informational, the deliveries stand without it
+	if err := w.writer.Append(record.ID, "webhookDeliveries", maxWebhookDeliveries, deliveries...); err != nil {
+		logger.Warn("unable to record webhook deliveries", zap.Error(err))
+	}
+
+	if len(failed) > 0 {
+		const msg = "unable to deliver webhook event"
+		logger.Error(msg, zap.Strings("endpoints", failed))
+		return joinSentIDs(endpoints, sent), fmt.Errorf(msg+" to (%d) endpoints: %s", len(failed), strings.Join(failed, ","))
+	}
+
+	return joinSentIDs(endpoints, sent), nil
+}
+
+// webhookEndpointID returns an ID of the endpoint that doesn't reveal its URL,
+// which may carry credentials
+func webhookEndpointID(endpointURL string) string {
+	sum := sha256.Sum256([]byte(endpointURL))
+
+	return hex.EncodeToString(sum[:6])
+}
+
+// deliver attempts to deliver the event to the endpoint until it is accepted,
+// a non-retryable response is received or the attempts are exhausted. The log
+// of every attempt is returned along with whether the delivery succeeded.
+func (w *Webhook) deliver(
+	ctx context.Context,
+	logger *zap.Logger,
+	endpoint WebhookEndpoint,
+	eventID string,
+	body []byte) ([]sales.WebhookDelivery, bool) {
+	logger = logger.With(zap.String("endpoint", redactURL(endpoint.URL)))
+
+	var logs []sales.WebhookDelivery
+	backoff := webhookBaseBackoff
+	for attempt := 1; attempt <= maxWebhookAttempts; attempt++ {
+		now := time.Now().UTC()
+		status, err := w.post(ctx, endpoint, eventID, body)
+		delivery := sales.WebhookDelivery{
+			Endpoint:   redactURL(endpoint.URL),
+			EventID:    eventID,
+			Attempt:    attempt,
+			StatusCode: status,
+			Duration:   time.Since(now).Milliseconds(),
+			Time:       &now,
+			Success:    err == nil,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		logs = append(logs, delivery)
+
+		if err == nil {
+			logger.Debug("delivered webhook event", zap.Int("attempt", attempt))
+			return logs, true
+		}
+
+		// only server errors, rate limits and network errors are worth
+		// retrying, anything else will fail the same way again
+		retryable := status == 0 || status == http.StatusTooManyRequests || status >= 500
+		logger.Warn(
+			"unable to deliver webhook event",
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+			zap.Bool("retryable", retryable),
+		)
+		if !retryable || attempt == maxWebhookAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return logs, false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return logs, false
+}
+
+// post signs and posts the event body to the endpoint, returning the response
+// status code
+func (w *Webhook) post(ctx context.Context, endpoint WebhookEndpoint, eventID string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventIDHeader, eventID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "v1="+SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// the error of the client contains the url, which may carry
+		// credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("unable to post event to %s: %w", redactURL(endpoint.URL), err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("received non-200 response: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+// using the secret. Receivers verify a request by computing the same signature
+// and comparing it in constant time with the signature header.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactURL removes the query string and user info from the URL as they may
+// carry credentials
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	parsed.RawQuery = ""
+	parsed.User = nil
+
+	return parsed.String()
+}
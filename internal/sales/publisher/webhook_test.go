@@ -0,0 +1,50 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignWebhook(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		signature string
+	}{
+		{
+			name:      "sale",
+			secret:    "secret",
+			timestamp: "1700000000",
+			body:      `{"id":"5xSig"}`,
+			signature: "4b3ffe71b1b2a62c05d2abdd8942fd6b46975044f8b2c812b0c2228613919553",
+		},
+		{
+			name:      "other secret",
+			secret:    "other",
+			timestamp: "1700000000",
+			body:      `{"id":"5xSig"}`,
+			signature: "778ccf175f68b999fc7b318e7d81d7929879b12af3e16b1dd57bfb51b2048bcd",
+		},
+		{
+			// a replayed body with a new timestamp doesn't verify
+			name:      "other timestamp",
+			secret:    "secret",
+			timestamp: "1700000001",
+			body:      `{"id":"5xSig"}`,
+			signature: "145f80ea4ddc9f33e765710543d19aa6af94f622c0f9ad2e16a6e7eb7d4f28d9",
+		},
+		{
+			name:      "empty body",
+			secret:    "secret",
+			timestamp: "1700000000",
+			signature: "4bc5f74d868b97888288889c5d9d65df02526f94c1592a79fdf4fe8b26e311e5",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.signature, SignWebhook(tc.secret, tc.timestamp, []byte(tc.body)))
+		})
+	}
+}
@@ -176,6 +176,144 @@ func (s *Service) List(condition Condition) ([]sales.Record, error) {
 	return records, nil
 }
 
+// OldestUnpublished returns the oldest sale, with a sale time after since,
+// that has not been published to the channel and is due its next attempt.
+// Dead-lettered sales are excluded, as are the sales without a publish state
+// for the channel, which were created before the channel was enabled.
+func (s *Service) OldestUnpublished(channel sales.PublishChannel, since time.Time) (*sales.Record, error) {
+	logger := s.logger.With(zap.String("channel", string(channel)))
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT x.* FROM " + fqn + " x" +
+		" WHERE x.saleTime >= $since" +
+		" AND x.publishes.[$channel].status NOT IN [$published, $dead]" +
+		" AND IFMISSINGORNULL(STR_TO_MILLIS(x.publishes.[$channel].nextAttemptAt), 0) <= $now" +
+		" ORDER BY x.saleTime ASC LIMIT 1"
+
+	options := gocb.QueryOptions{
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Timeout:         cbTimeout,
+		NamedParameters: map[string]interface{}{
+			"$since":     since.UTC().Format(time.RFC3339),
+			"$channel":   channel,
+			"$published": sales.PublishPublished,
+			"$dead":      sales.PublishDead,
+			"$now":       time.Now().UnixNano() / int64(time.Millisecond),
+		},
+	}
+
+	logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		const msg = "unable to query oldest unpublished sale"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	var rec sales.Record
+	if err := res.One(&rec); err != nil {
+		if errors.Is(err, gocb.ErrNoResult) {
+			return nil, sales.ErrNotFound
+		}
+		const msg = "unable to unmarshal record"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	return &rec, nil
+}
+
+// CountUnpublished returns the number of sales, with a sale time after since,
+// that have not been published to the channel, whether or not they are due
+// their next attempt. Dead-lettered sales, and sales created before the
+// channel was enabled, are excluded.
+func (s *Service) CountUnpublished(channel sales.PublishChannel, since time.Time) (int, error) {
+	logger := s.logger.With(zap.String("channel", string(channel)))
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT RAW COUNT(*) FROM " + fqn + " x" +
+		" WHERE x.saleTime >= $since" +
+		" AND x.publishes.[$channel].status NOT IN [$published, $dead]"
+
+	options := gocb.QueryOptions{
+		Timeout: cbTimeout,
+		NamedParameters: map[string]interface{}{
+			"$since":     since.UTC().Format(time.RFC3339),
+			"$channel":   channel,
+			"$published": sales.PublishPublished,
+			"$dead":      sales.PublishDead,
+		},
+		Readonly: true,
+	}
+
+	logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		const msg = "unable to count unpublished sales"
+		logger.Error(msg, zap.Error(err))
+		return 0, fmt.Errorf(msg+": %w", err)
+	}
+
+	var n int
+	if err := res.One(&n); err != nil {
+		const msg = "unable to unmarshal count"
+		logger.Error(msg, zap.Error(err))
+		return 0, fmt.Errorf(msg+": %w", err)
+	}
+
+	return n, nil
+}
+
+// ListByPublishStatus returns the sales that have the publish status on the
+// channel, ordered by sale time. An empty channel matches any channel.
+func (s *Service) ListByPublishStatus(channel sales.PublishChannel, status sales.PublishStatus) ([]sales.Record, error) {
+	logger := s.logger.With(zap.String("channel", string(channel)), zap.String("status", string(status)))
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT x.* FROM " + fqn + " x"
+	params := map[string]interface{}{
+		"$status": status,
+	}
+	if channel != "" {
+		stmt += " WHERE x.publishes.[$channel].status = $status"
+		params["$channel"] = channel
+	} else {
+		stmt += " WHERE ANY c IN OBJECT_NAMES(x.publishes) SATISFIES x.publishes.[c].status = $status END"
+	}
+	stmt += " ORDER BY x.saleTime ASC"
+
+	options := gocb.QueryOptions{
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Timeout:         cbTimeout,
+		NamedParameters: params,
+	}
+
+	logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		const msg = "unable to query sales by publish status"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	var records []sales.Record
+	for res.Next() {
+		var rec sales.Record
+		if err := res.Row(&rec); err != nil {
+			const msg = "unable to unmarshal record"
+			logger.Error(msg, zap.Error(err))
+			return nil, fmt.Errorf(msg+": %w", err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) == 0 {
+		return nil, sales.ErrNotFound
+	}
+
+	return records, nil
+}
+
 func (s *Service) setCollection() error {
 	bucket := s.cluster.Bucket(s.bucket)
 	if err := bucket.WaitUntilReady(cbTimeout, nil); err != nil {
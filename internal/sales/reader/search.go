@@ -0,0 +1,310 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	// DefaultSearchLimit and MaxSearchLimit are the default and maximum number
+	// of sales returned by a search
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 100
+)
+
+// Filter filters the sales returned by Search, zero values match any sale
+type Filter struct {
+	Collection  sales.NFTCollection
+	Marketplace string
+	Mint        string
+	Buyer       string
+	Seller      string
+
+	// MinPrice and MaxPrice are the inclusive price range, in lamports
+	MinPrice *uint64
+	MaxPrice *uint64
+
+	// From and To are the sale time range, From is inclusive and To exclusive
+	From *time.Time
+	To   *time.Time
+
+	// Before restricts the sales to those sold before the cursor's sale e.g.
+	// to compare a sale with the sales preceding it
+	Before *Cursor
+
+	// After is the position of the last sale of the previous page, in the
+	// search order
+	After *Cursor
+
+	// Order is the search order, most recent first when empty
+	Order Order
+
+	// Limit is the number of sales returned, DefaultSearchLimit when zero
+	Limit int
+}
+
+// Order is the order of the search results
+type Order string
+
+const (
+	// OrderRecent orders the sales by sale time, most recent first, then by ID
+	OrderRecent Order = ""
+
+	// OrderPrice orders the sales by price, highest first, ties by sale time,
+	// earliest first, then by ID
+	OrderPrice Order = "price"
+)
+
+// Cursor is the position of a sale in the search results. Price is only used
+// by OrderPrice.
+type Cursor struct {
+	SaleTime time.Time
+	ID       string
+	Price    uint64
+}
+
+// PageSize returns the number of sales returned for the filter
+func (f Filter) PageSize() int {
+	switch {
+	case f.Limit <= 0:
+		return DefaultSearchLimit
+	case f.Limit > MaxSearchLimit:
+		return MaxSearchLimit
+	default:
+		return f.Limit
+	}
+}
+
+// CursorOf returns the position of the sale
+func CursorOf(rec sales.Record) *Cursor {
+	c := Cursor{ID: rec.ID, Price: rec.Price}
+	if rec.SaleTime != nil {
+		c.SaleTime = *rec.SaleTime
+	}
+
+	return &c
+}
+
+// Search returns the sales matching the filter in the filter's order. The
+// cursor of the last sale is given as the filter's After to get the next page.
+func (s *Service) Search(filter Filter) ([]sales.Record, error) {
+	stmt, params := s.filterStatement("x.*", filter)
+
+	switch filter.Order {
+	case OrderRecent:
+		if filter.After != nil {
+			stmt += " AND (x.saleTime < $afterTime OR (x.saleTime = $afterTime AND x.id < $afterId))"
+		}
+		stmt += " ORDER BY x.saleTime DESC, x.id DESC"
+	case OrderPrice:
+		if filter.After != nil {
+			stmt += " AND (x.price < $afterPrice OR (x.price = $afterPrice AND" +
+				" (x.saleTime > $afterTime OR (x.saleTime = $afterTime AND x.id > $afterId))))"
+			params["$afterPrice"] = filter.After.Price
+		}
+		stmt += " ORDER BY x.price DESC, x.saleTime ASC, x.id ASC"
+	default:
+		return nil, fmt.Errorf("unknown search order: %s", filter.Order)
+	}
+
+	if filter.After != nil {
+		params["$afterTime"] = formatTime(&filter.After.SaleTime)
+		params["$afterId"] = filter.After.ID
+	}
+	stmt += " LIMIT " + strconv.Itoa(filter.PageSize())
+
+	return s.search(stmt, params)
+}
+
+// TopSales returns the sales matching the filter with the highest prices, in
+// OrderPrice
+func (s *Service) TopSales(filter Filter) ([]sales.Record, error) {
+	filter.Order = OrderPrice
+
+	return s.Search(filter)
+}
+
+// Totals returns the number of sales matching the filter and their total
+// price in lamports. The filter's After and Order are ignored.
+func (s *Service) Totals(filter Filter) (int, uint64, error) {
+	stmt, params := s.filterStatement("COUNT(*) AS `count`, IFMISSINGORNULL(SUM(x.price), 0) AS volume", filter)
+	options := gocb.QueryOptions{
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Timeout:         cbTimeout,
+		NamedParameters: params,
+		Readonly:        true,
+	}
+
+	s.logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		const msg = "unable to total sales"
+		s.logger.Error(msg, zap.Error(err))
+		return 0, 0, fmt.Errorf(msg+": %w", err)
+	}
+
+	var totals struct {
+		Count  int    `json:"count"`
+		Volume uint64 `json:"volume"`
+	}
+	if err := res.One(&totals); err != nil {
+		const msg = "unable to unmarshal totals"
+		s.logger.Error(msg, zap.Error(err))
+		return 0, 0, fmt.Errorf(msg+": %w", err)
+	}
+
+	return totals.Count, totals.Volume, nil
+}
+
+// filterStatement returns the statement selecting the projection of the sales
+// matching the filter, and its parameters, to which the pagination and
+// ordering are appended
+func (s *Service) filterStatement(projection string, filter Filter) (string, map[string]interface{}) {
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT " + projection + " FROM " + fqn + " x WHERE x.saleTime IS NOT MISSING"
+	params := make(map[string]interface{})
+
+	for _, f := range []struct {
+		clause string
+		param  string
+		value  interface{}
+		ok     bool
+	}{
+		{clause: "x.collection = $collection", param: "$collection", value: filter.Collection, ok: filter.Collection != ""},
+		{clause: "x.marketplace = $marketplace", param: "$marketplace", value: filter.Marketplace, ok: filter.Marketplace != ""},
+		{clause: "x.mintPubkey = $mint", param: "$mint", value: filter.Mint, ok: filter.Mint != ""},
+		{clause: "x.buyer = $buyer", param: "$buyer", value: filter.Buyer, ok: filter.Buyer != ""},
+		{clause: "x.seller = $seller", param: "$seller", value: filter.Seller, ok: filter.Seller != ""},
+		{clause: "x.price >= $minPrice", param: "$minPrice", value: filter.MinPrice, ok: filter.MinPrice != nil},
+		{clause: "x.price <= $maxPrice", param: "$maxPrice", value: filter.MaxPrice, ok: filter.MaxPrice != nil},
+		{clause: "x.saleTime >= $from", param: "$from", value: formatTime(filter.From), ok: filter.From != nil},
+		{clause: "x.saleTime < $to", param: "$to", value: formatTime(filter.To), ok: filter.To != nil},
+	} {
+		if !f.ok {
+			continue
+		}
+		stmt += " AND " + f.clause
+		params[f.param] = f.value
+	}
+
+	if filter.Before != nil {
+		stmt += " AND (x.saleTime < $beforeTime OR (x.saleTime = $beforeTime AND x.id < $beforeId))"
+		params["$beforeTime"] = formatTime(&filter.Before.SaleTime)
+		params["$beforeId"] = filter.Before.ID
+	}
+
+	return stmt, params
+}
+
+func (s *Service) search(stmt string, params map[string]interface{}) ([]sales.Record, error) {
+	options := gocb.QueryOptions{
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Timeout:         cbTimeout,
+		NamedParameters: params,
+	}
+
+	s.logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		const msg = "unable to search sales"
+		s.logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	var records []sales.Record
+	for res.Next() {
+		var rec sales.Record
+		if err := res.Row(&rec); err != nil {
+			const msg = "unable to unmarshal record"
+			s.logger.Error(msg, zap.Error(err))
+			return nil, fmt.Errorf(msg+": %w", err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) == 0 {
+		return nil, sales.ErrNotFound
+	}
+
+	return records, nil
+}
+
+// formatTime formats the time as it is stored, sale times are stored in UTC
+// so that they sort as strings
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Position is the position of a sale in the order sales were created, which
+// is the order they were detected in
+type Position struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// PositionOf returns the position of the sale
+func PositionOf(rec sales.Record) *Position {
+	p := Position{ID: rec.ID}
+	if rec.CreatedAt != nil {
+		p.CreatedAt = *rec.CreatedAt
+	}
+
+	return &p
+}
+
+// CreatedAfter returns the sales of the collections created after the
+// position, oldest first. Empty collections match every collection. The limit
+// is capped at MaxSearchLimit as for Search.
+func (s *Service) CreatedAfter(after Position, collections []sales.NFTCollection, limit int) ([]sales.Record, error) {
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+
+	// creation times are compared as milliseconds since RFC 3339 strings with
+	// fractional seconds don't sort as strings
+	stmt := "SELECT x.* FROM " + fqn + " x WHERE x.createdAt IS NOT MISSING" +
+		" AND (STR_TO_MILLIS(x.createdAt) > $afterMillis OR (STR_TO_MILLIS(x.createdAt) = $afterMillis AND x.id > $afterId))"
+	params := map[string]interface{}{
+		"$afterMillis": after.CreatedAt.UnixNano() / int64(time.Millisecond),
+		"$afterId":     after.ID,
+	}
+	if len(collections) > 0 {
+		stmt += " AND x.collection IN $collections"
+		params["$collections"] = collections
+	}
+	stmt += " ORDER BY STR_TO_MILLIS(x.createdAt) ASC, x.id ASC LIMIT " + strconv.Itoa(Filter{Limit: limit}.PageSize())
+
+	return s.search(stmt, params)
+}
+
+// LatestByMint returns the most recent sale of each of the mints, in a single
+// query. Mints without sales are missing from the result.
+func (s *Service) LatestByMint(mints []string) (map[string]sales.Record, error) {
+	latest := make(map[string]sales.Record, len(mints))
+	if len(mints) == 0 {
+		return latest, nil
+	}
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT RAW MAX([x.saleTime, x.id, x])[2] FROM " + fqn + " x" +
+		" WHERE x.saleTime IS NOT MISSING AND x.mintPubkey IN $mints GROUP BY x.mintPubkey"
+
+	records, err := s.search(stmt, map[string]interface{}{"$mints": mints})
+	if err != nil && !errors.Is(err, sales.ErrNotFound) {
+		return nil, err
+	}
+	for i := range records {
+		latest[records[i].MintPubkey] = records[i]
+	}
+
+	return latest, nil
+}
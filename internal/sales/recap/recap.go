@@ -0,0 +1,416 @@
+package recap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/ledger"
+	"bromato-sales/internal/sales/posts"
+	"bromato-sales/internal/sales/publisher"
+	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/stats"
+)
+
+const (
+	// CouchbaseCollection is the Couchbase collection, in the sales scope, in
+	// which the posted recaps are recorded
+	CouchbaseCollection = "recaps"
+
+	// maxLateness is how late after its scheduled time a recap is still
+	// posted, e.g. when the tracker was restarted or the leader changed around
+	// the scheduled time
+	maxLateness = time.Hour
+
+	// checkInterval is how often the schedules are checked for due recaps
+	checkInterval = time.Minute
+)
+
+// Period is the period summarised by a recap, ending at its scheduled time
+type Period struct {
+	// Name identifies the period e.g. daily
+	Name string
+
+	// Title is the period as shown in the posts e.g. Daily
+	Title string
+
+	Length time.Duration
+}
+
+var (
+	Daily  = Period{Name: "daily", Title: "Daily", Length: 24 * time.Hour}
+	Weekly = Period{Name: "weekly", Title: "Weekly", Length: 7 * 24 * time.Hour}
+)
+
+// MediaSource provides the image of the top sale's NFT
+type MediaSource interface {
+	NFTMedia(ctx context.Context, record sales.Record, channel sales.PublishChannel) (*publisher.Media, error)
+}
+
+// Config is the configuration of the recaps
+type Config struct {
+	// DailySchedule and WeeklySchedule are the cron specs, e.g. 0 14 * * *,
+	// at which the recaps are posted. Schedules are in UTC unless prefixed
+	// with a CRON_TZ= time zone, an empty schedule disables the recap.
+	DailySchedule  string
+	WeeklySchedule string
+
+	// Owner uniquely identifies the instance posting the recaps
+	Owner string
+}
+
+// Recapper posts scheduled recaps of the sales of each collection to every
+// poster. Each recap is recorded before it is posted so that it is never
+// posted twice, whichever replica posts it. A recap interrupted while being
+// posted is not retried as it may have been posted.
+type Recapper struct {
+	bucket    string
+	cluster   *gocb.Cluster
+	ledger    *ledger.Ledger
+	logger    *zap.Logger
+	media     MediaSource
+	owner     string
+	posters   []publisher.Poster
+	reader    *reader.Service
+	schedules []*schedule
+	stats     *stats.Service
+	templates *posts.Templates
+}
+
+// details describes a recap in its ledger entries
+type details struct {
+	Period     string              `json:"period"`
+	Collection sales.NFTCollection `json:"collection"`
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+}
+
+type schedule struct {
+	period Period
+	spec   cron.Schedule
+
+	// posted is the scheduled time of the last recap posted by the instance
+	posted time.Time
+}
+
+func NewRecapper(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	bucket string,
+	st *stats.Service,
+	r *reader.Service,
+	templates *posts.Templates,
+	media MediaSource,
+	cfg Config,
+	posters ...publisher.Poster) (*Recapper, error) {
+	rc := Recapper{
+		bucket:    bucket,
+		cluster:   cluster,
+		logger:    logger,
+		media:     media,
+		owner:     cfg.Owner,
+		posters:   posters,
+		reader:    r,
+		stats:     st,
+		templates: templates,
+	}
+
+	if err := rc.validate(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range []struct {
+		period Period
+		spec   string
+	}{
+		{period: Daily, spec: cfg.DailySchedule},
+		{period: Weekly, spec: cfg.WeeklySchedule},
+	} {
+		if s.spec == "" {
+			continue
+		}
+		spec, err := cron.ParseStandard(s.spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s recap schedule: %w", s.period.Name, err)
+		}
+		rc.schedules = append(rc.schedules, &schedule{period: s.period, spec: spec})
+	}
+
+	l, err := ledger.New(rc.logger, rc.cluster, rc.bucket, CouchbaseCollection, rc.owner)
+	if err != nil {
+		return nil, err
+	}
+	rc.ledger = l
+
+	return &rc, nil
+}
+
+func (rc *Recapper) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return rc.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return rc.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return rc.bucket != "" },
+		},
+		{
+			dep: "stats",
+			chk: func() bool { return rc.stats != nil },
+		},
+		{
+			dep: "reader",
+			chk: func() bool { return rc.reader != nil },
+		},
+		{
+			dep: "templates",
+			chk: func() bool { return rc.templates != nil },
+		},
+		{
+			dep: "media",
+			chk: func() bool { return rc.media != nil },
+		},
+		{
+			dep: "owner",
+			chk: func() bool { return rc.owner != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize recapper due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Run posts the recaps as they are due until the context is done. A failed
+// recap known not to have been posted is retried on the next check while it
+// is within maxLateness.
+func (rc *Recapper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		for _, s := range rc.schedules {
+			due := lastScheduled(s.spec, now)
+			if due == nil || !due.After(s.posted) {
+				continue
+			}
+
+			if err := rc.Post(ctx, s.period, *due); err != nil {
+				rc.logger.Error("unable to post recap, retrying", zap.Error(err), zap.String("period", s.period.Name))
+				continue
+			}
+			s.posted = *due
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lastScheduled returns the latest scheduled time, within maxLateness, up to
+// now. Nil is returned when nothing was scheduled in that time.
+func lastScheduled(spec cron.Schedule, now time.Time) *time.Time {
+	t := spec.Next(now.Add(-maxLateness))
+	if t.IsZero() || t.After(now) {
+		return nil
+	}
+
+	for {
+		next := spec.Next(t)
+		if next.IsZero() || next.After(now) {
+			return &t
+		}
+		t = next
+	}
+}
+
+// Post posts the recap of the period ending at end for every collection with
+// sales in the period. Recaps already posted are skipped, so posting a period
+// again is safe.
+func (rc *Recapper) Post(ctx context.Context, period Period, end time.Time) error {
+	end = end.UTC()
+	from := end.Add(-period.Length)
+	logger := rc.logger.With(zap.String("period", period.Name), zap.Time("end", end))
+
+	current, err := rc.stats.Range(from, end, stats.Filter{})
+	if err != nil {
+		const msg = "unable to get period stats"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	previous, err := rc.stats.Range(from.Add(-period.Length), from, stats.Filter{})
+	if err != nil {
+		const msg = "unable to get previous period stats"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+	prev := make(map[sales.NFTCollection]stats.Summary, len(previous))
+	for _, st := range previous {
+		prev[st.Collection] = st.Summary
+	}
+
+	if len(current) == 0 {
+		logger.Info("no sales to recap")
+		return nil
+	}
+
+	var errs error
+	for _, st := range current {
+		recap := posts.Recap{
+			Period:         period.Title,
+			Collection:     st.Collection,
+			From:           from,
+			To:             end,
+			Count:          st.Summary.Count,
+			Volume:         st.Summary.Volume,
+			PreviousCount:  prev[st.Collection].Count,
+			PreviousVolume: prev[st.Collection].Volume,
+		}
+		recap.TopMarketplace, recap.TopMarketplaceCount = topMarketplace(st.Marketplaces)
+
+		top, err := rc.reader.TopSales(reader.Filter{Collection: st.Collection, From: &from, To: &end, Limit: 1})
+		switch {
+		case err == nil:
+			recap.TopSale = &top[0]
+		case errors.Is(err, sales.ErrNotFound):
+		default:
+			const msg = "unable to get top sale"
+			logger.Error(msg, zap.Error(err))
+			errs = multierr.Append(errs, fmt.Errorf(msg+": %w", err))
+			continue
+		}
+
+		for _, p := range rc.posters {
+			if err := rc.post(ctx, logger, p, period, recap); err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+func (rc *Recapper) post(ctx context.Context, logger *zap.Logger, p publisher.Poster, period Period, recap posts.Recap) error {
+	channel := p.Channel()
+	logger = logger.With(zap.String("channel", string(channel)), zap.String("collection", string(recap.Collection)))
+
+	text, err := rc.templates.RenderRecap(ctx, channel, recap)
+	if err != nil {
+		const msg = "unable to render recap"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	e := ledger.Entry{
+		Key:     "recap::" + period.Name + "::" + string(recap.Collection) + "::" + recap.To.UTC().Format(time.RFC3339) + "::" + string(channel),
+		Channel: channel,
+		Details: details{
+			Period:     period.Name,
+			Collection: recap.Collection,
+			From:       recap.From,
+			To:         recap.To,
+		},
+	}
+	err = rc.ledger.Claim(&e)
+	switch {
+	case err == nil:
+	case errors.Is(err, ledger.ErrAlreadyPosted):
+		logger.Debug("recap already posted")
+		return nil
+	default:
+		const msg = "unable to claim recap"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	post := publisher.Post{
+		Title:      period.Title + " Recap",
+		Text:       text,
+		Collection: recap.Collection,
+		Key:        e.Key,
+	}
+	// the recap is still worth posting without the image
+	if recap.TopSale != nil {
+		post.Media, err = rc.media.NFTMedia(ctx, *recap.TopSale, channel)
+		if err != nil {
+			logger.Warn("unable to get top sale media", zap.Error(err))
+		}
+		post.AltText = "Image of " + recap.TopSale.NFT.Name + ", the top sale of the period"
+	}
+
+	id, err := p.Post(ctx, post)
+	if err != nil {
+		// the recap is retried on the next check unless it may have been
+		// posted, in which case it keeps its claim
+		if errors.Is(err, publisher.ErrNotPosted) {
+			rc.ledger.Release(&e)
+		}
+		const msg = "unable to post recap"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+" to %s: %w", channel, err)
+	}
+
+	if err := rc.ledger.Complete(&e, id); err != nil {
+		// the recap was posted, it won't be posted again as the claim remains
+		logger.Warn("unable to record posted recap", zap.Error(err))
+	}
+	logger.Info("posted recap", zap.String("externalId", id))
+
+	return nil
+}
+
+// topMarketplace returns the marketplace with the most sales, ties are broken
+// by name so that every channel agrees
+func topMarketplace(marketplaces map[string]stats.Summary) (string, int) {
+	names := make([]string, 0, len(marketplaces))
+	for m := range marketplaces {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+
+	var (
+		top   string
+		count int
+	)
+	for _, m := range names {
+		if c := marketplaces[m].Count; c > count && m != "" {
+			top, count = m, c
+		}
+	}
+
+	return top, count
+}
@@ -10,7 +10,12 @@ const (
 	// are stored
 	CouchbaseCollection = "sales"
 
-	Twitter PublishChannel = "twitter"
+	Twitter  PublishChannel = "twitter"
+	Discord  PublishChannel = "discord"
+	Telegram PublishChannel = "telegram"
+	Slack    PublishChannel = "slack"
+	Mastodon PublishChannel = "mastodon"
+	Webhook  PublishChannel = "webhook"
 )
 
 // Record represents the sales record of the NFT
@@ -20,7 +25,6 @@ type Record struct {
 	ID string `json:"id"`
 
 	// Buyer is the buyer's pub key address of the nft
-	// DEPRECATED
 	Buyer string `json:"buyer"`
 
 	// Collection communicates the NFT collection e.g. bad-bromatoes
@@ -40,10 +44,14 @@ type Record struct {
 	Price uint64 `json:"price"`
 
 	// PublishDetails communicates the details of the posting to twitter
+	// DEPRECATED: replaced by Publishes
 	PublishDetails *PublishDetails `json:"publishDetails"`
 
+	// Publishes communicates the publish state of the sale for every channel
+	// it has been, or is being, published to
+	Publishes map[PublishChannel]*PublishState `json:"publishes"`
+
 	// Seller is the pubkey address of the seller of the nft
-	// DEPRECATED
 	Seller string `json:"seller"`
 
 	// SaleTime is the time in which the sale occurred
@@ -51,8 +59,13 @@ type Record struct {
 
 	NFT NFT `json:"nft"`
 
+	// WebhookDeliveries is the log of the latest delivery attempts of the sale
+	// to the outbound webhook endpoints
+	WebhookDeliveries []WebhookDelivery `json:"webhookDeliveries"`
+
 	// TwitterMediaID represents the media id of the bromato PNG file.
 	// This is needed to have the picture of the bromato in the tweet.
+	// DEPRECATED: the twitter publisher uploads the media when publishing
 	TwitterMediaID string `json:"twitterMediaId"`
 }
 
@@ -63,9 +76,8 @@ type NFT struct {
 	MetadataURI string `json:"metadataURI"`
 }
 
-// PublishDetails is the object that holds the information regarding the
-// publishing of the sales to a certain social media platform. At the moment
-// only twitter is allowed.
+// PublishDetails is the legacy record of the publishing of a sale to its
+// single channel, read when migrating to the publish states
 type PublishDetails struct {
 	ID      string         `json:"id"`
 	Channel PublishChannel `json:"channel"`
@@ -73,6 +85,97 @@ type PublishDetails struct {
 	Success bool           `json:"success"`
 }
 
+// WebhookDelivery is a single attempt at delivering a sale event to an
+// outbound webhook endpoint
+type WebhookDelivery struct {
+	// Endpoint is the endpoint URL with its query string removed
+	Endpoint string `json:"endpoint"`
+
+	// EventID is the ID of the delivered event
+	EventID string `json:"eventId"`
+
+	// Attempt is the 1-indexed attempt number of the delivery
+	Attempt int `json:"attempt"`
+
+	// StatusCode is the status code returned by the endpoint, zero when no
+	// response was received
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Error is the reason the delivery failed
+	Error string `json:"error,omitempty"`
+
+	// Duration is the duration of the request in milliseconds
+	Duration int64 `json:"durationMs"`
+
+	// Time is the time the delivery was attempted
+	Time *time.Time `json:"time"`
+
+	// Success communicates whether the endpoint accepted the event
+	Success bool `json:"success"`
+}
+
+// PublishState is the state of the publishing of a sale to a single channel
+type PublishState struct {
+	// Status of the publishing
+	Status PublishStatus `json:"status"`
+
+	// Attempts is the number of times publishing has been attempted
+	Attempts int `json:"attempts"`
+
+	// LastError is the error of the last failed attempt
+	LastError string `json:"lastError"`
+
+	// ExternalID is the ID of the post on the channel e.g. the tweet ID
+	ExternalID string `json:"externalId"`
+
+	// FirstAttemptAt is the time of the first publish attempt
+	FirstAttemptAt *time.Time `json:"firstAttemptAt"`
+
+	// LastAttemptAt is the time of the latest publish attempt
+	LastAttemptAt *time.Time `json:"lastAttemptAt"`
+
+	// PublishedAt is the time the sale was successfully published
+	PublishedAt *time.Time `json:"publishedAt"`
+
+	// NextAttemptAt is the earliest time the next publish attempt can be made,
+	// set after a failed attempt according to the retry policy
+	NextAttemptAt *time.Time `json:"nextAttemptAt"`
+
+	// DeadLetteredAt is the time the publishing was given up on after
+	// exhausting its attempts
+	DeadLetteredAt *time.Time `json:"deadLetteredAt"`
+
+	// LeaseOwner is the instance that claimed the publishing while it is
+	// being sent
+	LeaseOwner string `json:"leaseOwner,omitempty"`
+
+	// LeaseExpiresAt is the time the claim of the LeaseOwner expires
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+}
+
+// PublishStatus is the status of the publishing of a sale to a channel
+type PublishStatus string
+
+const (
+	// PublishPending communicates the sale has yet to be published
+	PublishPending PublishStatus = "pending"
+
+	// PublishFailed communicates the last publish attempt failed
+	PublishFailed PublishStatus = "failed"
+
+	// PublishSending communicates the sale is claimed and being sent to the
+	// channel. A sending state whose lease expired was interrupted after the
+	// send started, whether the sale was published is unknown.
+	PublishSending PublishStatus = "sending"
+
+	// PublishPublished communicates the sale was published
+	PublishPublished PublishStatus = "published"
+
+	// PublishDead communicates the publishing exhausted its attempts and was
+	// dead-lettered. It is not retried until it is requeued.
+	PublishDead PublishStatus = "dead"
+)
+
 type PublishChannel string
 
 type Marketplace string
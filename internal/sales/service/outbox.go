@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+// The publish states of a sale form its outbox, one publish job per channel,
+// created together with the sale. A job is claimed with a lease before it is
+// sent and completed afterwards, both with a compare-and-swap on the sale's
+// document, so that concurrent instances never send the same job.
+//
+// A crash between sending and completing leaves the job claimed. Once its
+// lease expires the job is dead-lettered rather than retried, as there is no
+// way of knowing whether the post went out, trading a possibly missed post
+// for never posting a sale twice. Dead-lettered jobs are requeued by hand.
+
+// Lease identifies the instance claiming publish jobs and how long its claims
+// last. The duration must exceed the time it takes to get a sale's media and
+// publish it to a channel.
+type Lease struct {
+	Owner    string
+	Duration time.Duration
+}
+
+// errSkipJob aborts a claim of a job that must not be sent
+var errSkipJob = errors.New("publish job skipped")
+
+// completeAttempts is the number of times completing a job is attempted, a
+// job that is not completed is dead-lettered once its lease expires
+const completeAttempts = 3
+
+// claim claims the channel's publish job of the sale. errSkipJob is returned
+// when the job is done or claimed by another instance.
+func (s *Service) claim(logger *zap.Logger, id string, channel sales.PublishChannel) (*sales.PublishState, error) {
+	now := time.Now().UTC()
+
+	state, err := s.writer.UpdatePublishState(id, channel, func(cur *sales.PublishState) (*sales.PublishState, error) {
+		state := sales.PublishState{Status: sales.PublishPending}
+		if cur != nil {
+			state = *cur
+		}
+
+		switch state.Status {
+		case sales.PublishPublished, sales.PublishDead:
+			return nil, errSkipJob
+		case sales.PublishSending:
+			if state.LeaseExpiresAt != nil && state.LeaseExpiresAt.After(now) {
+				return nil, errSkipJob
+			}
+
+			// the previous attempt was interrupted mid send
+			logger.Warn("dead-lettering sale after its publish lease expired", zap.String("leaseOwner", state.LeaseOwner))
+			state.Status = sales.PublishDead
+			state.LastError = fmt.Sprintf("publish lease of %s expired, the sale may have been published", state.LeaseOwner)
+			state.NextAttemptAt = nil
+			state.DeadLetteredAt = &now
+			state.LeaseOwner = ""
+			state.LeaseExpiresAt = nil
+			return &state, nil
+		}
+
+		expires := now.Add(s.lease.Duration)
+		state.Status = sales.PublishSending
+		state.Attempts++
+		state.LastAttemptAt = &now
+		if state.FirstAttemptAt == nil {
+			state.FirstAttemptAt = &now
+		}
+		state.LeaseOwner = s.lease.Owner
+		state.LeaseExpiresAt = &expires
+		// keeps the sale from being picked up again while it is being sent
+		state.NextAttemptAt = &expires
+
+		return &state, nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errSkipJob), errors.Is(err, sales.ErrConflict):
+		logger.Debug("publish job already claimed or done")
+		return nil, errSkipJob
+	default:
+		const msg = "unable to claim publish job"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	if state.Status != sales.PublishSending {
+		return nil, errSkipJob
+	}
+
+	return state, nil
+}
+
+// complete records the outcome of the claimed job. It only succeeds while the
+// job is still claimed by this instance, so it is safe to retry.
+func (s *Service) complete(
+	logger *zap.Logger,
+	id string,
+	channel sales.PublishChannel,
+	outcome func(state *sales.PublishState)) error {
+	var err error
+	for i := 0; i < completeAttempts; i++ {
+		_, err = s.writer.UpdatePublishState(id, channel, func(cur *sales.PublishState) (*sales.PublishState, error) {
+			if cur == nil || cur.Status != sales.PublishSending || cur.LeaseOwner != s.lease.Owner {
+				return nil, errSkipJob
+			}
+
+			state := *cur
+			state.LeaseOwner = ""
+			state.LeaseExpiresAt = nil
+			outcome(&state)
+
+			return &state, nil
+		})
+		if err == nil || errors.Is(err, errSkipJob) {
+			break
+		}
+		logger.Warn("unable to complete publish job, retrying", zap.Error(err), zap.Int("attempt", i+1))
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errSkipJob):
+		const msg = "publish job lease lost before completing"
+		logger.Error(msg)
+		return errors.New(msg)
+	default:
+		const msg = "unable to complete publish job"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+}
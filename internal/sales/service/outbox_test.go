@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"bromato-sales/internal/sales"
+)
+
+func TestClaim(t *testing.T) {
+	var (
+		past   = time.Now().Add(-time.Minute)
+		future = time.Now().Add(time.Minute)
+	)
+
+	for _, tc := range []struct {
+		name      string
+		state     *sales.PublishState
+		conflicts int
+		claimed   bool
+		// after is the stored state after the claim, nil when the claim
+		// leaves it as it was
+		after *sales.PublishState
+	}{
+		{
+			name:    "pending",
+			claimed: true,
+		},
+		{
+			name:    "failed",
+			state:   &sales.PublishState{Status: sales.PublishFailed, Attempts: 1, NextAttemptAt: &past},
+			claimed: true,
+		},
+		{
+			name:  "published",
+			state: &sales.PublishState{Status: sales.PublishPublished, Attempts: 1},
+		},
+		{
+			name:  "dead",
+			state: &sales.PublishState{Status: sales.PublishDead, Attempts: 3},
+		},
+		{
+			name:  "claimed by another instance",
+			state: &sales.PublishState{Status: sales.PublishSending, Attempts: 1, LeaseOwner: "other", LeaseExpiresAt: &future},
+		},
+		{
+			// the other instance may have published the sale before dying
+			name:  "lease expired",
+			state: &sales.PublishState{Status: sales.PublishSending, Attempts: 1, LeaseOwner: "other", LeaseExpiresAt: &past},
+			after: &sales.PublishState{Status: sales.PublishDead, Attempts: 1},
+		},
+		{
+			// another instance claimed the job concurrently
+			name:      "conflict",
+			state:     &sales.PublishState{Status: sales.PublishPending},
+			conflicts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newFakeWriter()
+			s := newTestService(t, w)
+			if tc.state != nil {
+				w.set("sig", sales.Twitter, *tc.state)
+			}
+			w.conflicts = tc.conflicts
+
+			state, err := s.claim(s.logger, "sig", sales.Twitter)
+			stored, _ := w.state("sig", sales.Twitter)
+
+			if !tc.claimed {
+				require.True(t, errors.Is(err, errSkipJob))
+				require.Nil(t, state)
+
+				switch {
+				case tc.after != nil:
+					require.Equal(t, tc.after.Status, stored.Status)
+					require.Equal(t, tc.after.Attempts, stored.Attempts)
+					require.NotNil(t, stored.DeadLetteredAt)
+					require.Empty(t, stored.LeaseOwner)
+					require.Nil(t, stored.LeaseExpiresAt)
+				case tc.state != nil:
+					require.Equal(t, *tc.state, stored)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, stored, *state)
+			require.Equal(t, sales.PublishSending, state.Status)
+			require.Equal(t, s.lease.Owner, state.LeaseOwner)
+			require.NotNil(t, state.LeaseExpiresAt)
+			require.Equal(t, state.LeaseExpiresAt, state.NextAttemptAt)
+			require.NotNil(t, state.FirstAttemptAt)
+
+			attempts := 1
+			if tc.state != nil {
+				attempts += tc.state.Attempts
+			}
+			require.Equal(t, attempts, state.Attempts)
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+
+	for _, tc := range []struct {
+		name      string
+		owner     string
+		conflicts int
+		completed bool
+	}{
+		{
+			name:      "claimed",
+			owner:     "test",
+			completed: true,
+		},
+		{
+			// the lease expired and the job was claimed by another instance
+			name:  "lease lost",
+			owner: "other",
+		},
+		{
+			name:      "conflicts retried",
+			owner:     "test",
+			conflicts: completeAttempts - 1,
+			completed: true,
+		},
+		{
+			name:      "conflicts exhausted",
+			owner:     "test",
+			conflicts: completeAttempts,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newFakeWriter()
+			s := newTestService(t, w)
+			claimed := sales.PublishState{
+				Status:         sales.PublishSending,
+				Attempts:       1,
+				LeaseOwner:     tc.owner,
+				LeaseExpiresAt: &expires,
+			}
+			w.set("sig", sales.Twitter, claimed)
+			w.conflicts = tc.conflicts
+
+			err := s.complete(s.logger, "sig", sales.Twitter, func(state *sales.PublishState) {
+				state.Status = sales.PublishPublished
+				state.ExternalID = "tweet"
+			})
+			stored, _ := w.state("sig", sales.Twitter)
+
+			if !tc.completed {
+				require.Error(t, err)
+				require.Equal(t, claimed, stored)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, sales.PublishPublished, stored.Status)
+			require.Equal(t, "tweet", stored.ExternalID)
+			require.Empty(t, stored.LeaseOwner)
+			require.Nil(t, stored.LeaseExpiresAt)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"time"
+)
+
+// RetryPolicy determines how failed publish attempts of a sale to a channel
+// are retried. The wait between attempts doubles after every failed attempt,
+// starting at BaseBackoff and capped at MaxBackoff. After MaxAttempts failed
+// attempts the sale is dead-lettered on the channel.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts made before dead-lettering
+	MaxAttempts int
+
+	// BaseBackoff is the wait after the first failed attempt
+	BaseBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff time.Duration
+}
+
+// Backoff returns the wait before the next attempt after the given number of
+// failed attempts
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+
+	backoff := p.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return backoff
+}
+
+// Exhausted returns true when no more attempts are allowed after the given
+// number of failed attempts
+func (p RetryPolicy) Exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		backoff  time.Duration
+	}{
+		{
+			name:     "no attempts",
+			policy:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 0,
+			backoff:  0,
+		},
+		{
+			name:     "first attempt",
+			policy:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 1,
+			backoff:  time.Minute,
+		},
+		{
+			name:     "doubles",
+			policy:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 3,
+			backoff:  4 * time.Minute,
+		},
+		{
+			name:     "capped",
+			policy:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 7,
+			backoff:  time.Hour,
+		},
+		{
+			// doubling would overflow without the cap
+			name:     "capped after many attempts",
+			policy:   RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+			attempts: 100,
+			backoff:  time.Hour,
+		},
+		{
+			name:     "uncapped",
+			policy:   RetryPolicy{BaseBackoff: time.Minute},
+			attempts: 7,
+			backoff:  64 * time.Minute,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.backoff, tc.policy.Backoff(tc.attempts))
+		})
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		policy    RetryPolicy
+		attempts  int
+		exhausted bool
+	}{
+		{
+			name:      "attempts left",
+			policy:    RetryPolicy{MaxAttempts: 3},
+			attempts:  2,
+			exhausted: false,
+		},
+		{
+			name:      "last attempt",
+			policy:    RetryPolicy{MaxAttempts: 3},
+			attempts:  3,
+			exhausted: true,
+		},
+		{
+			name:      "past the last attempt",
+			policy:    RetryPolicy{MaxAttempts: 3},
+			attempts:  4,
+			exhausted: true,
+		},
+		{
+			name:      "unlimited",
+			policy:    RetryPolicy{},
+			attempts:  100,
+			exhausted: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exhausted, tc.policy.Exhausted(tc.attempts))
+		})
+	}
+}
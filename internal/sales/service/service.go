@@ -1,55 +1,93 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"mime/multipart"
-	"net/http"
-	"net/url"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dghubble/oauth1"
 	bin "github.com/gagliardetto/binary"
 	token_metadata "github.com/gagliardetto/metaplex-go/clients/token-metadata"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 
+	"bromato-sales/internal/metrics"
 	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/card"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/gateway"
+	"bromato-sales/internal/sales/media"
+	"bromato-sales/internal/sales/publisher"
 	"bromato-sales/internal/sales/reader"
 	"bromato-sales/internal/sales/writer"
 )
 
 const (
 	badBromotoesAlphaArtCollectionID = "bad-bromatoes"
-	maxChunkSizeInBytes              = 1024 * 1024
-	solscanURL                       = "https://solscan.io"
+
+	// maxMetadataBytes is the size limit of the NFT's off-chain metadata
+	maxMetadataBytes = 1024 * 1024
 )
 
+// publishSalesSince is the sale time from which sales are published, older
+// sales predate the tracker posting
+var publishSalesSince = time.Date(2021, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+// salesWriter writes the sales records, implemented by the writer service
+type salesWriter interface {
+	Create(rec *sales.Record) error
+	MigratePublishDetails() error
+	UpdatePublishState(
+		id string,
+		channel sales.PublishChannel,
+		update func(current *sales.PublishState) (*sales.PublishState, error)) (*sales.PublishState, error)
+}
+
 type Service struct {
-	logger       *zap.Logger
-	solClient    *rpc.Client
-	reader       *reader.Service
-	writer       *writer.Service
-	twitterToken string
+	logger      *zap.Logger
+	solClient   *rpc.Client
+	reader      *reader.Service
+	writer      salesWriter
+	retryPolicy RetryPolicy
+	lease       Lease
+	resolver    *gateway.Resolver
+	media       *media.Processor
+	cards       *card.Renderer
+	bus         *events.Bus
+	publishers  []publisher.Publisher
 }
 
-func NewService(logger *zap.Logger, r *reader.Service, w *writer.Service, solClient *rpc.Client) (*Service, error) {
+func NewService(
+	logger *zap.Logger,
+	r *reader.Service,
+	w *writer.Service,
+	solClient *rpc.Client,
+	retryPolicy RetryPolicy,
+	lease Lease,
+	resolver *gateway.Resolver,
+	mediaProcessor *media.Processor,
+	cards *card.Renderer,
+	bus *events.Bus,
+	publishers ...publisher.Publisher) (*Service, error) {
 	s := Service{
-		logger:       logger,
-		solClient:    solClient,
-		reader:       r,
-		writer:       w,
-		twitterToken: os.Getenv("TWITTER_TOKEN"),
+		logger:      logger,
+		solClient:   solClient,
+		reader:      r,
+		retryPolicy: retryPolicy,
+		lease:       lease,
+		resolver:    resolver,
+		media:       mediaProcessor,
+		cards:       cards,
+		bus:         bus,
+		publishers:  publishers,
+	}
+	if w != nil {
+		s.writer = w
 	}
 
 	if err := s.validate(); err != nil {
@@ -80,6 +118,26 @@ func (s *Service) validate() error {
 			dep: "writer",
 			chk: func() bool { return s.writer != nil },
 		},
+		{
+			dep: "resolver",
+			chk: func() bool { return s.resolver != nil },
+		},
+		{
+			dep: "media",
+			chk: func() bool { return s.media != nil },
+		},
+		{
+			dep: "lease",
+			chk: func() bool { return s.lease.Owner != "" && s.lease.Duration > 0 },
+		},
+		{
+			dep: "bus",
+			chk: func() bool { return s.bus != nil },
+		},
+		{
+			dep: "retryPolicy",
+			chk: func() bool { return s.retryPolicy.MaxAttempts > 0 && s.retryPolicy.BaseBackoff > 0 },
+		},
 	} {
 		if !tc.chk() {
 			missingDeps = append(missingDeps, tc.dep)
@@ -97,13 +155,23 @@ func (s *Service) validate() error {
 	return nil
 }
 
-// Create will create the sales record in the db.
+// Create will create the sales record in the db and emit a SaleDetected
+// event.
 func (s *Service) Create(rec sales.Record) (*sales.Record, error) {
 	logger := s.logger.With(zap.String("salesId", rec.ID))
 
 	now := time.Now().UTC()
 	rec.CreatedAt = &now
 
+	if rec.Publishes == nil {
+		rec.Publishes = make(map[sales.PublishChannel]*sales.PublishState, len(s.publishers))
+	}
+	for _, p := range s.publishers {
+		if _, ok := rec.Publishes[p.Channel()]; !ok {
+			rec.Publishes[p.Channel()] = &sales.PublishState{Status: sales.PublishPending}
+		}
+	}
+
 	if err := s.writer.Create(&rec); err != nil {
 		const msg = "unable to create sales record"
 		s.logger.Error(msg, zap.Error(err))
@@ -112,12 +180,15 @@ func (s *Service) Create(rec sales.Record) (*sales.Record, error) {
 
 	logger.Debug("successfully created sales record")
 
+	s.bus.Emit(events.SaleDetected{Sale: rec, DetectedAt: now})
+
 	return &rec, nil
 }
 
 // SaveNewSales queries a royalty address and saves new sale records if they
-// txn sigs come from the supported marketplace sales.
-func (s *Service) SaveNewSales(royaltyAddress string) error {
+// txn sigs come from the supported marketplace sales. It stops between
+// signatures once the context is done, returning the context's error.
+func (s *Service) SaveNewSales(ctx context.Context, royaltyAddress string) error {
 	logger := s.logger.With(zap.String("royaltyAddress", royaltyAddress))
 
 	pk, err := solana.PublicKeyFromBase58(royaltyAddress)
@@ -148,12 +219,20 @@ func (s *Service) SaveNewSales(royaltyAddress string) error {
 	// than 20 sales in the last iteration.
 findNewSales:
 	for !done {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		opts := rpc.GetSignaturesForAddressOpts{
 			Before: before,
 			Until:  *until,
 			Limit:  &limit,
 		}
-		signatures, err := s.solClient.GetSignaturesForAddressWithOpts(context.Background(), pk, &opts)
+		var signatures []*rpc.TransactionSignature
+		err := metrics.ObserveRPC("getSignaturesForAddress", func() (err error) {
+			signatures, err = s.solClient.GetSignaturesForAddressWithOpts(ctx, pk, &opts)
+			return err
+		})
 		if err != nil {
 			const msg = "unable to get signatures for address"
 			logger.Error(msg, zap.Error(err))
@@ -181,27 +260,30 @@ findNewSales:
 			if caughtUp {
 				break findNewSales
 			}
+			metrics.SignaturesScanned.Inc()
 
 			// get the signature transaction to ensure it was a marketplace
 			// sale
-			tx, err := s.getTransaction(logger, signatures[i].Signature)
+			tx, err := s.getTransaction(ctx, logger, signatures[i].Signature)
 			if err != nil {
 				const msg = "unable to get transaction"
 				logger.Error(msg, zap.Error(err))
 				return fmt.Errorf(msg+": %w", err)
 			}
 			if tx == nil {
+				metrics.SalesSkipped.WithLabelValues(string(metrics.SkipNoTransaction)).Inc()
 				continue
 			}
 
 			keys := tx.Transaction.GetParsedTransaction().Message.AccountKeys
 			m, ok := isMarketplaceSale(keys)
 			if !ok {
+				metrics.SalesSkipped.WithLabelValues(string(metrics.SkipNotMarketplace)).Inc()
 				continue
 			}
 
 			// we found a marketplace sale, get the metadata and add to the list
-			meta, err := s.getTokenMetadata(logger, tx.Meta.PostTokenBalances[0].Mint)
+			meta, err := s.getTokenMetadata(ctx, logger, tx.Meta.PostTokenBalances[0].Mint)
 			if err != nil {
 				const msg = "unable to get token metadata"
 				logger.Error(msg, zap.Error(err))
@@ -219,7 +301,9 @@ findNewSales:
 				return fmt.Errorf(msg+": %w", err)
 			}
 
-			time.Sleep(time.Millisecond * 250)
+			if err := sleep(ctx, time.Millisecond*250); err != nil {
+				return err
+			}
 		}
 
 		// set before time to the oldest sale we have
@@ -228,19 +312,53 @@ findNewSales:
 		logger.Debug("new sales so far", zap.Int("numSales", newSales))
 
 		// pause for rate limiting
-		time.Sleep(time.Second * 6)
+		if err := sleep(ctx, time.Second*6); err != nil {
+			return err
+		}
 	}
 
 	logger.Debug("saved new sales", zap.Int("numSales", newSales))
+	metrics.Succeeded(metrics.Ingestion)
 
 	return nil
 }
 
-// PublishNewSales finds the oldest sale that has yet to be published and
-// publishes it to Twitter. The metadata such as the image is retrieved at
-// runtime.
-func (s *Service) PublishNewSales(skipPublish bool) error {
-	oldest, err := s.getOldestNonPublished()
+// PublishNewSales publishes, for every configured publisher, the oldest sale
+// that has yet to be published to the publisher's channel. The metadata such
+// as the image is retrieved at runtime. A failure on one channel does not stop
+// the other channels from publishing, nor is it recorded as a failed run of
+// publishing, the channels' runs are recorded on their own.
+func (s *Service) PublishNewSales(ctx context.Context, skipPublish bool) error {
+	var errs error
+
+	// channels are usually publishing the same sale, only fetch its metadata
+	// once. The media itself is cached by the media processor.
+	metadata := make(map[string]*nftMetadata)
+	for _, p := range s.publishers {
+		if err := s.publishOldest(ctx, p, metadata, skipPublish); err != nil {
+			errs = multierr.Append(errs, err)
+		} else {
+			metrics.Succeeded(metrics.PublishingTo(string(p.Channel())))
+		}
+		s.recordQueueDepth(p.Channel())
+	}
+
+	// a failing channel is reported on its own rather than as the publishing
+	// loop being stuck
+	metrics.Succeeded(metrics.Publishing)
+
+	return errs
+}
+
+func (s *Service) publishOldest(
+	ctx context.Context,
+	p publisher.Publisher,
+	metadata map[string]*nftMetadata,
+	skipPublish bool) error {
+	channel := p.Channel()
+	logger := s.logger.With(zap.String("channel", string(channel)))
+
+	oldest, err := s.getOldestNonPublished(logger, channel)
 	switch err {
 	case nil:
 	case sales.ErrNotFound:
@@ -249,55 +367,131 @@ func (s *Service) PublishNewSales(skipPublish bool) error {
 		return err
 	}
 
-	logger := s.logger.With(zap.String("saleId", oldest.ID))
+	logger = logger.With(zap.String("saleId", oldest.ID))
 	logger.Debug("publishing oldest non-published sale")
 
-	mediaID, err := s.processMetadataImage(logger, oldest)
-	if err != nil {
-		const msg = "unable to process metadata image"
-		logger.Error(msg, zap.Error(err))
-		return fmt.Errorf(msg+": %w", err)
-	}
-	oldest.TwitterMediaID = mediaID
+	return s.publish(ctx, logger, p, oldest, metadata, skipPublish)
+}
+
+// publish claims the channel's publish job of the sale and publishes it.
+// Failing to get the sale's metadata or media is a failed attempt like
+// failing to publish, so that a sale whose media can't be fetched is retried
+// with backoff and eventually dead-lettered rather than blocking the newer
+// sales.
+func (s *Service) publish(
+	ctx context.Context,
+	logger *zap.Logger,
+	p publisher.Publisher,
+	oldest *sales.Record,
+	metadata map[string]*nftMetadata,
+	skipPublish bool) error {
+	channel := p.Channel()
 
 	if skipPublish {
+		if _, err := s.saleMedia(ctx, logger, oldest, metadata, channel); err != nil {
+			return err
+		}
 		logger.Debug("skipping publish")
 		return nil
 	}
 
-	success := true
-	id, err := s.publishSaleTweet(logger, *oldest)
+	state, err := s.claim(logger, oldest.ID, channel)
+	switch {
+	case err == nil:
+	case errors.Is(err, errSkipJob):
+		return nil
+	default:
+		return err
+	}
+
+	metrics.PublishAttempts.WithLabelValues(string(channel)).Inc()
+	var id string
+	m, publishErr := s.saleMedia(ctx, logger, oldest, metadata, channel)
+	if publishErr == nil {
+		id, publishErr = p.Publish(ctx, *oldest, m)
+	}
+	if publishErr != nil {
+		metrics.PublishFailures.WithLabelValues(string(channel)).Inc()
+	}
+	now := time.Now().UTC()
+	err = s.complete(logger, oldest.ID, channel, func(state *sales.PublishState) {
+		if publishErr != nil && id != "" {
+			// the destinations the publisher did post to are skipped on retry
+			state.ExternalID = id
+		}
+
+		switch {
+		case publishErr == nil:
+			state.Status = sales.PublishPublished
+			state.ExternalID = id
+			state.LastError = ""
+			state.PublishedAt = &now
+			state.NextAttemptAt = nil
+		case s.retryPolicy.Exhausted(state.Attempts):
+			// stop retrying so newer sales are no longer blocked behind this one
+			state.Status = sales.PublishDead
+			state.LastError = publishErr.Error()
+			state.NextAttemptAt = nil
+			state.DeadLetteredAt = &now
+			logger.Warn("dead-lettering sale after exhausting attempts", zap.Int("attempts", state.Attempts))
+		default:
+			next := now.Add(s.retryPolicy.Backoff(state.Attempts))
+			state.Status = sales.PublishFailed
+			state.LastError = publishErr.Error()
+			state.NextAttemptAt = &next
+		}
+	})
 	if err != nil {
-		const msg = "unable to publish sales tweet"
+		const msg = "unable to record publishing"
 		logger.Error(msg, zap.Error(err))
 		return fmt.Errorf(msg+": %w", err)
 	}
 
-	now := time.Now().UTC()
-	publishDetails := sales.PublishDetails{
-		ID:      id,
-		Channel: sales.Twitter,
-		Time:    &now,
-		Success: success,
+	if publishErr != nil {
+		const msg = "unable to publish sale"
+		logger.Error(msg, zap.Error(publishErr), zap.Int("attempts", state.Attempts))
+		return fmt.Errorf(msg+" to %s: %w", channel, publishErr)
 	}
+	logger.Debug("published sale", zap.String("externalId", id))
 
-	updates := []writer.Update{
-		{
-			Field: "twitterMediaId",
-			Value: mediaID,
-		},
-		{
-			Field: "publishDetails",
-			Value: &publishDetails,
-		},
+	s.bus.Emit(events.SalePublished{
+		Sale:        *oldest,
+		Channel:     channel,
+		ExternalID:  id,
+		PublishedAt: now,
+	})
+
+	return nil
+}
+
+// saleMedia returns the sale's media processed for the channel. The metadata
+// is cached by sale as the channels are usually publishing the same sale.
+func (s *Service) saleMedia(
+	ctx context.Context,
+	logger *zap.Logger,
+	record *sales.Record,
+	metadata map[string]*nftMetadata,
+	channel sales.PublishChannel) (*publisher.Media, error) {
+	md, ok := metadata[record.ID]
+	if !ok {
+		var err error
+		md, err = s.getMetadata(ctx, logger, record)
+		if err != nil {
+			const msg = "unable to get metadata"
+			logger.Error(msg, zap.Error(err))
+			return nil, fmt.Errorf(msg+": %w", err)
+		}
+		metadata[record.ID] = md
 	}
-	if err := s.writer.UpdateFields(oldest.ID, updates...); err != nil {
-		const msg = "unable to update fields to reflect twitter media id"
+
+	m, err := s.processMetadataImage(ctx, logger, record, md, channel)
+	if err != nil {
+		const msg = "unable to process metadata image"
 		logger.Error(msg, zap.Error(err))
-		return fmt.Errorf(msg+": %w", err)
+		return nil, fmt.Errorf(msg+": %w", err)
 	}
 
-	return nil
+	return m, nil
 }
 
 func (s *Service) createSalesRecord(
@@ -307,8 +501,15 @@ func (s *Service) createSalesRecord(
 	meta *token_metadata.Metadata,
 	marketplace string) error {
 	saleTime := rpcSig.BlockTime.Time().UTC()
+	buyer, seller := getBuyerSeller(
+		tx.Transaction.GetParsedTransaction().Message.AccountKeys,
+		tx.Meta.PreBalances,
+		tx.Meta.PostBalances,
+	)
 	sale := sales.Record{
 		ID:          rpcSig.Signature.String(),
+		Buyer:       buyer,
+		Seller:      seller,
 		Collection:  badBromotoesAlphaArtCollectionID,
 		Marketplace: marketplace,
 		MintPubkey:  tx.Meta.PostTokenBalances[0].Mint.String(),
@@ -327,6 +528,7 @@ func (s *Service) createSalesRecord(
 	// TODO: find a better way to do this
 	if sale.Price < 50000000 && sale.Marketplace == "Solsea" {
 		logger.Debug("price under accepted amount, skipping", zap.Uint("price", uint(sale.Price)))
+		metrics.SalesSkipped.WithLabelValues(string(metrics.SkipBelowMinPrice)).Inc()
 		return nil
 	}
 
@@ -338,6 +540,74 @@ func (s *Service) createSalesRecord(
 	}
 
 	logger.Debug("created sale", zap.String("id", sale.ID))
+	metrics.SalesCreated.WithLabelValues(sale.Marketplace).Inc()
+
+	return nil
+}
+
+// MigratePublishState migrates the sales records that predate the per channel
+// publish state so that previously published sales are not published again
+func (s *Service) MigratePublishState() error {
+	if err := s.writer.MigratePublishDetails(); err != nil {
+		const msg = "unable to migrate publish details"
+		s.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	return nil
+}
+
+// ListDeadLettered returns the sales that were dead-lettered on the channel.
+// An empty channel returns the sales dead-lettered on any channel.
+func (s *Service) ListDeadLettered(channel sales.PublishChannel) ([]sales.Record, error) {
+	records, err := s.reader.ListByPublishStatus(channel, sales.PublishDead)
+	switch err {
+	case nil:
+	case sales.ErrNotFound:
+		return nil, nil
+	default:
+		const msg = "unable to list dead-lettered sales"
+		s.logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	return records, nil
+}
+
+// Requeue moves a sale that was dead-lettered on the channel back into the
+// publish queue with a fresh set of attempts. The last error is kept for
+// reference until the next attempt. The state is updated with a
+// compare-and-swap, like the claims of the outbox, so a job claimed or
+// requeued concurrently isn't overwritten.
+func (s *Service) Requeue(id string, channel sales.PublishChannel) error {
+	logger := s.logger.With(zap.String("saleId", id), zap.String("channel", string(channel)))
+
+	_, err := s.writer.UpdatePublishState(id, channel, func(cur *sales.PublishState) (*sales.PublishState, error) {
+		if cur == nil || cur.Status != sales.PublishDead {
+			return nil, errSkipJob
+		}
+
+		state := *cur
+		state.Status = sales.PublishPending
+		state.Attempts = 0
+		state.NextAttemptAt = nil
+		state.DeadLetteredAt = nil
+
+		return &state, nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errSkipJob):
+		const msg = "sale is not dead-lettered on channel"
+		logger.Error(msg)
+		return fmt.Errorf(msg+": %s", channel)
+	default:
+		const msg = "unable to requeue sale"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	logger.Debug("requeued sale")
 
 	return nil
 }
@@ -358,114 +628,177 @@ func (s *Service) isCaughtUp(logger *zap.Logger, signature string) (bool, error)
 	}
 }
 
-func (s *Service) processMetadataImage(logger *zap.Logger, record *sales.Record) (string, error) {
-	imageURI, err := s.getImageURI(logger, record)
+// nftMetadata is the media of the NFT's off-chain metadata
+type nftMetadata struct {
+	Image        string `json:"image"`
+	AnimationURL string `json:"animation_url"`
+
+	// card is the rendered sale card, shared by the channels
+	card *media.Image
+}
+
+// processMetadataImage returns the NFT's media processed for the channel. When
+// sale cards are enabled the card is attached instead of the NFT's image and
+// animation.
+func (s *Service) processMetadataImage(
+	ctx context.Context,
+	logger *zap.Logger,
+	record *sales.Record,
+	md *nftMetadata,
+	channel sales.PublishChannel) (*publisher.Media, error) {
+	logger.Debug("image uri", zap.String("uri", md.Image), zap.String("animationUri", md.AnimationURL))
+
+	original, err := s.media.Original(ctx, record.MintPubkey, md.Image)
 	if err != nil {
-		const msg = "unable to get image URI"
+		const msg = "unable to get image"
 		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
+		return nil, fmt.Errorf(msg+": %w", err)
 	}
 
-	// attempt to get the extension
-	imageExt := "png"
-	imageParts := strings.Split(imageURI, "?ext=")
-	if len(imageParts) > 1 {
-		imageExt = imageParts[1]
+	key := record.MintPubkey
+	if s.cards != nil {
+		if md.card == nil {
+			md.card, err = s.cards.Render(ctx, *record, original)
+			if err != nil {
+				// the sale is still worth publishing with the plain image
+				logger.Warn("unable to render sale card", zap.Error(err))
+			}
+		}
+		if md.card != nil {
+			original, key = md.card, "card/"+record.ID
+		}
 	}
 
-	logger.Debug("image uri", zap.String("uri", imageURI))
-
-	// download image
-	image, err := s.downloadImage(logger, imageURI)
+	image, err := s.media.Variant(key, original, channel)
 	if err != nil {
-		const msg = "unable to download image"
+		const msg = "unable to process image"
 		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+	m := &publisher.Media{
+		Data:        image.Data,
+		ContentType: image.ContentType,
+		Ext:         publisher.MediaExt(image.ContentType),
+		URI:         md.Image,
 	}
 
-	// upload image
-	mediaID, err := s.uploadImageTwitter(logger, imageExt, image)
-	if err != nil {
-		const msg = "unable to upload image to twitter"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
+	// the animation is optional, the sale is still published with the image
+	if md.AnimationURL != "" && md.card == nil {
+		animation, err := s.media.Animation(ctx, record.MintPubkey, md.AnimationURL)
+		if err != nil {
+			logger.Warn("unable to get animation", zap.Error(err))
+		} else {
+			m.Animation = &publisher.Media{
+				Data:        animation.Data,
+				ContentType: animation.ContentType,
+				Ext:         publisher.MediaExt(animation.ContentType),
+				URI:         md.AnimationURL,
+			}
+		}
 	}
 
-	return mediaID, nil
+	return m, nil
 }
 
-func (s *Service) getImageURI(logger *zap.Logger, record *sales.Record) (string, error) {
-	// get metadata
-	c := new(http.Client)
-
-	req, err := http.NewRequest(http.MethodGet, record.NFT.MetadataURI, nil)
-	if err != nil {
-		const msg = "unable to create metadata request"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
+// Posters returns the configured publishers that can post other than sales
+func (s *Service) Posters() []publisher.Poster {
+	posters := make([]publisher.Poster, 0, len(s.publishers))
+	for _, p := range s.publishers {
+		if poster, ok := p.(publisher.Poster); ok {
+			posters = append(posters, poster)
+		}
 	}
 
-	resp, err := c.Do(req)
-	if err != nil {
-		const msg = "unable to get metadata"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
+	return posters
+}
 
-	var m map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		const msg = "unable to decode metadata"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
+// Channels returns the channels of the configured publishers
+func (s *Service) Channels() []sales.PublishChannel {
+	channels := make([]sales.PublishChannel, 0, len(s.publishers))
+	for _, p := range s.publishers {
+		channels = append(channels, p.Channel())
 	}
-	resp.Body.Close()
 
-	imageURI, ok := m["image"].(string)
-	if !ok {
-		const msg = "unable to find image uri from metadata"
-		logger.Error(msg)
-		return "", errors.New(msg)
+	return channels
+}
+
+// Verifiers returns the configured publishers whose credentials can be
+// verified
+func (s *Service) Verifiers() []publisher.Verifier {
+	verifiers := make([]publisher.Verifier, 0, len(s.publishers))
+	for _, p := range s.publishers {
+		if v, ok := p.(publisher.Verifier); ok {
+			verifiers = append(verifiers, v)
+		}
 	}
 
-	return imageURI, nil
+	return verifiers
 }
 
-func (s *Service) downloadImage(logger *zap.Logger, imageURI string) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, imageURI, nil)
+// NFTMedia returns the image of the sale's NFT processed for the channel. The
+// image is attached as is, without its sale card or animation, for posts that
+// feature the NFT other than its sale e.g. recaps.
+func (s *Service) NFTMedia(ctx context.Context, record sales.Record, channel sales.PublishChannel) (*publisher.Media, error) {
+	logger := s.logger.With(zap.String("saleId", record.ID), zap.String("channel", string(channel)))
+
+	md, err := s.getMetadata(ctx, logger, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := s.media.Original(ctx, record.MintPubkey, md.Image)
 	if err != nil {
-		const msg = "unable to create download image request"
+		const msg = "unable to get image"
 		logger.Error(msg, zap.Error(err))
 		return nil, fmt.Errorf(msg+": %w", err)
 	}
 
-	c := new(http.Client)
-
-	resp, err := c.Do(req)
+	image, err := s.media.Variant(record.MintPubkey, original, channel)
 	if err != nil {
-		const msg = "unable to download image"
+		const msg = "unable to process image"
 		logger.Error(msg, zap.Error(err))
 		return nil, fmt.Errorf(msg+": %w", err)
 	}
 
-	// can't stream this to twitter directly from the body becuz twitter
-	// needs to know the total bytes before starting :)))))
-	image, err := ioutil.ReadAll(resp.Body)
+	return &publisher.Media{
+		Data:        image.Data,
+		ContentType: image.ContentType,
+		Ext:         publisher.MediaExt(image.ContentType),
+		URI:         md.Image,
+	}, nil
+}
+
+// getMetadata gets the NFT's off-chain metadata
+func (s *Service) getMetadata(ctx context.Context, logger *zap.Logger, record *sales.Record) (*nftMetadata, error) {
+	b, err := s.resolver.Fetch(ctx, record.NFT.MetadataURI, maxMetadataBytes)
 	if err != nil {
-		const msg = "unable to read image body"
+		const msg = "unable to get metadata"
 		logger.Error(msg, zap.Error(err))
 		return nil, fmt.Errorf(msg+": %w", err)
 	}
-	resp.Body.Close()
 
-	return image, nil
+	var m nftMetadata
+	if err := json.Unmarshal(b, &m); err != nil {
+		const msg = "unable to decode metadata"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	if m.Image == "" {
+		const msg = "unable to find image uri from metadata"
+		logger.Error(msg)
+		return nil, errors.New(msg)
+	}
+
+	return &m, nil
 }
 
-func (s *Service) getTokenMetadata(logger *zap.Logger, mint solana.PublicKey) (*token_metadata.Metadata, error) {
+func (s *Service) getTokenMetadata(ctx context.Context, logger *zap.Logger, mint solana.PublicKey) (*token_metadata.Metadata, error) {
 	// we found a marketplace sale, get the metadata and add to the list
 	//mint := tx.Meta.PostTokenBalances[0].Mint
 	var pda solana.PublicKey
 	var err error
-	s.retryRPC(func() error {
+	if err := s.retryRPC(ctx, func() error {
 		pda, _, err = solana.FindTokenMetadataAddress(mint)
 		if err != nil {
 			const msg = "unable to get token metadata address"
@@ -474,18 +807,25 @@ func (s *Service) getTokenMetadata(logger *zap.Logger, mint solana.PublicKey) (*
 		}
 
 		return nil
-	}, 3, time.Second*45)
+	}, 3, time.Second*45); err != nil {
+		return nil, fmt.Errorf("unable to get token metadata address: %w", err)
+	}
 
 	out := new(rpc.GetAccountInfoResult)
-	s.retryRPC(func() error {
-		out, err = s.solClient.GetAccountInfo(context.Background(), pda)
+	if err := s.retryRPC(ctx, func() error {
+		err = metrics.ObserveRPC("getAccountInfo", func() (err error) {
+			out, err = s.solClient.GetAccountInfo(ctx, pda)
+			return err
+		})
 		if err != nil {
 			const msg = "unable to get account info for pda"
 			logger.Error(msg, zap.Error(err))
 			return fmt.Errorf(msg+": %w", err)
 		}
 		return nil
-	}, 3, time.Second*45)
+	}, 3, time.Second*45); err != nil {
+		return nil, fmt.Errorf("unable to get account info for pda: %w", err)
+	}
 
 	var meta token_metadata.Metadata
 
@@ -525,11 +865,14 @@ func (s *Service) getOldestSaleSignature(logger *zap.Logger) (*solana.Signature,
 	return &until, nil
 }
 
-func (s *Service) getTransaction(logger *zap.Logger, sig solana.Signature) (*rpc.GetTransactionResult, error) {
+func (s *Service) getTransaction(ctx context.Context, logger *zap.Logger, sig solana.Signature) (*rpc.GetTransactionResult, error) {
 	tx := new(rpc.GetTransactionResult)
 	var err error
-	if err := s.retryRPC(func() error {
-		tx, err = s.solClient.GetTransaction(context.Background(), sig, nil)
+	if err := s.retryRPC(ctx, func() error {
+		err = metrics.ObserveRPC("getTransaction", func() (err error) {
+			tx, err = s.solClient.GetTransaction(ctx, sig, nil)
+			return err
+		})
 		if err != nil {
 			const msg = "unable to get transaction"
 			logger.Error(msg, zap.Error(err), zap.String("signature", sig.String()))
@@ -538,7 +881,7 @@ func (s *Service) getTransaction(logger *zap.Logger, sig solana.Signature) (*rpc
 
 		return nil
 	}, 3, time.Second*45); err != nil {
-		fmt.Errorf("unable to get transaction: %w", err)
+		return nil, fmt.Errorf("unable to get transaction: %w", err)
 	}
 
 	if tx.Meta == nil {
@@ -554,385 +897,32 @@ func (s *Service) getTransaction(logger *zap.Logger, sig solana.Signature) (*rpc
 	return tx, nil
 }
 
-func (s *Service) publishSaleTweet(logger *zap.Logger, rec sales.Record) (string, error) {
-	path := "https://api.twitter.com/2/tweets"
-	saleText := "New Bromato Sale!\n" + "Name: " + rec.NFT.Name + "\n"
-
-	price := toSolPriceStr(rec.Price)
-	if price != "" {
-		saleText += "Price: " + toSolPriceStr(rec.Price) + " SOL\n"
-	}
-
-	if rec.Marketplace != "" {
-		saleText += "Marketplace: " + rec.Marketplace + "\n"
-	}
-
-	if rec.SaleTime != nil {
-		saleText += "Sale Time: " + rec.SaleTime.UTC().String() + "\n"
-	}
-
-	saleText += "Transaction: " + solscanURL + "/tx/" + rec.ID + "\n"
-	saleText += "#Bromato"
-
-	payload := Post{
-		Text: saleText,
-		Media: Media{
-			MediaIds: []string{rec.TwitterMediaID},
-		},
-	}
-
-	// upload image to twitter
-	c := authTwitter(Credentials{
-		ConsumerKey:       os.Getenv("TWITTER_CONSUMER_KEY"),
-		ConsumerSecret:    os.Getenv("TWITTER_CONSUMER_SECRET"),
-		AccessToken:       os.Getenv("TWITTER_ACCESS_TOKEN"),
-		AccessTokenSecret: os.Getenv("TWITTER_ACCESS_TOKEN_SECRET"),
-	})
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		const msg = "unable to marshal tweet body"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
-	if err != nil {
-		const msg = "unable to create request"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.Do(req)
-	if err != nil {
-		const msg = "unable to post tweet"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		if resp.StatusCode == 429 {
-			epoch, err := strconv.Atoi(resp.Header["X-Rate-Limit-Reset"][0])
-			if err != nil {
-				const msg = "unable to convert rate limit reset to int"
-				logger.Error(msg, zap.Error(err))
-				return "", fmt.Errorf(msg+": %w", err)
-			}
-			reset := time.Unix(int64(epoch), 0)
-			logger.Error(
-				"rate limit, sleeping until reset",
-				zap.Strings("rate-limit", resp.Header["X-Rate-Limit-Limit"]),
-				zap.Strings("rate-limit-remaining", resp.Header["X-Rate-Limit-Remaining"]),
-				zap.Int64("rate-limit-reset-minutes", int64(time.Until(reset).Minutes())),
-			)
-
-			time.Sleep(time.Until(reset))
-		}
-		if resp.Body != nil {
-			b, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				const msg = "cant read body"
-				logger.Error(msg, zap.Error(err))
-				return "", fmt.Errorf(msg+": %w", err)
-			}
-			str := string(b)
-			logger.Error("msg body", zap.String("body", str))
-		}
-		const msg = "received non 200 response"
-		logger.Error(msg, zap.Error(err), zap.Int("statusCode", resp.StatusCode))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	var tr TweetResp
-	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
-		const msg = "unable to decode tweet response"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	return tr.TweetData.ID, nil
-}
-
-func (s *Service) uploadImageTwitter(logger *zap.Logger, ext string, image []byte) (string, error) {
-	// upload image to twitter
-	c := authTwitter(Credentials{
-		ConsumerKey:       os.Getenv("TWITTER_CONSUMER_KEY"),
-		ConsumerSecret:    os.Getenv("TWITTER_CONSUMER_SECRET"),
-		AccessToken:       os.Getenv("TWITTER_ACCESS_TOKEN"),
-		AccessTokenSecret: os.Getenv("TWITTER_ACCESS_TOKEN_SECRET"),
-	})
-
-	uploadURL, err := url.Parse("https://upload.twitter.com/1.1/media/upload.json")
-	if err != nil {
-		const msg = "unable to parse upload url"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-	mediaID, err := s.uploadImageInit(logger, c, uploadURL, len(image), ext)
-	if err != nil {
-		const msg = "unable to upload limit INIT"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	logger.Debug("upload init start", zap.String("mediaId", mediaID))
-
-	// upload image data using APPEND
-	if err := s.uploadImageAppend(logger, c, uploadURL, image, mediaID); err != nil {
-		const msg = "unable to upload image APPEND"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-	logger.Debug("uploaded image", zap.String("mediaId", mediaID))
-
-	// finalize upload
-	if err := s.uploadImageFinalize(logger, c, uploadURL, mediaID); err != nil {
-		const msg = "unable to upload image FINALIZE"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	return mediaID, nil
-}
-
-// TODO: can prob put these methods in a twitter service but eh, time..
-func (s *Service) uploadImageInit(
-	logger *zap.Logger,
-	c *http.Client,
-	uploadURL *url.URL,
-	totalBytes int,
-	ext string) (string, error) {
-	q := uploadURL.Query()
-	q.Set("command", "INIT")
-	q.Set("media_type", "image/"+ext)
-	q.Set("media_category", "tweet_image")
-	q.Set("total_bytes", strconv.Itoa(totalBytes))
-	uploadURL.RawQuery = q.Encode()
-
-	// create request for INIT upload
-	req, err := http.NewRequest(http.MethodPost, uploadURL.String(), nil)
-	if err != nil {
-		const msg = "unable to create upload image request"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		const msg = "unable to upload image"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		if resp.Body != nil {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return "", fmt.Errorf("unable to read body: %w", err)
-			}
-			logger.Error("body", zap.String("body", string(body)))
-		}
-		const msg = "unable to init image"
-		logger.Error(msg, zap.Int("status", resp.StatusCode))
-		return "", errors.New(msg)
-	}
-
-	var r struct {
-		MediaID string `json:"media_id_string"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		const msg = "unable to decode upload image response"
-		logger.Error(msg, zap.Error(err))
-		return "", fmt.Errorf(msg+": %w", err)
-	}
-	resp.Body.Close()
-
-	return r.MediaID, nil
-}
-
-func (s *Service) uploadImageAppend(
-	logger *zap.Logger,
-	c *http.Client,
-	uploadURL *url.URL,
-	image []byte,
-	mediaID string) error {
-	q := make(url.Values)
-	q.Set("command", "APPEND")
-	q.Set("media_id", mediaID)
-	var i int
-	for len(image) > 0 {
-		chunk := image[:min(len(image), maxChunkSizeInBytes)]
-
-		buf := new(bytes.Buffer)
-		writer := multipart.NewWriter(buf)
-		part, err := writer.CreateFormFile("media", "media")
-		if err != nil {
-			const msg = "unable to create form file"
-			logger.Error(msg, zap.Error(err))
-			return fmt.Errorf(msg+": %w", err)
-		}
-		if _, err := io.Copy(part, bytes.NewReader(chunk)); err != nil {
-			const msg = "unable to copy"
-			logger.Error(msg, zap.Error(err))
-			return fmt.Errorf(msg+": %w", err)
-		}
-		writer.Close()
-
-		q.Set("segment_index", strconv.Itoa(i))
-		uploadURL.RawQuery = q.Encode()
-
-		req, err := http.NewRequest(http.MethodPost, uploadURL.String(), buf)
-		if err != nil {
-			const msg = "unable to append image request"
-			logger.Error(msg, zap.Error(err))
-			return fmt.Errorf(msg+": %w", err)
-		}
-
-		req.Header.Add("Content-Type", writer.FormDataContentType())
-		req.Header.Set("Content-Length", strconv.Itoa(len(chunk)))
-
-		resp, err := c.Do(req)
-		if err != nil {
-			const msg = "unable to append image"
-			logger.Error(msg, zap.Error(err))
-			return fmt.Errorf(msg+": %w", err)
-		}
-
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			const msg = "received non-200 response from twitter"
-			logger.Error(msg, zap.Int("status", resp.StatusCode))
-			if resp.Body != nil {
-				body, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					return fmt.Errorf("unable to read body: %w", err)
-				}
-				logger.Error("body", zap.String("body", string(body)))
-			}
-			return fmt.Errorf(msg+": %d", resp.StatusCode)
-		}
-		i++
-		image = image[min(len(image), maxChunkSizeInBytes):]
-	}
-
-	return nil
-}
-
-func (s *Service) uploadImageFinalize(
-	logger *zap.Logger,
-	c *http.Client,
-	uploadURL *url.URL,
-	mediaID string) error {
-	q := make(url.Values)
-	q.Set("command", "FINALIZE")
-	q.Set("media_id", mediaID)
-	uploadURL.RawQuery = q.Encode()
-	req, err := http.NewRequest(http.MethodPost, uploadURL.String(), nil)
-	if err != nil {
-		const msg = "unable to create finalize image upload request"
-		logger.Error(msg, zap.Error(err))
-		return fmt.Errorf(msg+": %w", err)
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return fmt.Errorf("unable to finalize image upload: %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		if resp.Body != nil {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf("unable to read body: %w", err)
-			}
-			logger.Error("body", zap.String("body", string(body)))
-		}
-		const msg = "received non-200 response from twitter"
-		logger.Error(msg, zap.Int("status", resp.StatusCode))
-		return fmt.Errorf(msg+": %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
-func (s *Service) getOldestNonPublished() (*sales.Record, error) {
-	oldestRes, err := s.reader.List(reader.Condition{
-		Wheres: []reader.Where{
-			{
-				Field:    "publishDetails",
-				Operator: "IS NULL",
-			},
-			{
-				Field:    "saleTime",
-				Operator: ">=",
-				Value:    "2021-12-01T00:00:00Z",
-			},
-		},
-		OrderBy:       "saleTime",
-		SortDirection: "ASC",
-		Limit:         1,
-	})
-
+func (s *Service) getOldestNonPublished(logger *zap.Logger, channel sales.PublishChannel) (*sales.Record, error) {
+	oldest, err := s.reader.OldestUnpublished(channel, publishSalesSince)
 	switch err {
 	case nil:
 	case sales.ErrNotFound:
-		s.logger.Debug("no sales to publish")
+		logger.Debug("no sales to publish")
 		return nil, sales.ErrNotFound
 	default:
 		const msg = "unable to get oldest sale"
-		s.logger.Error(msg, zap.Error(err))
+		logger.Error(msg, zap.Error(err))
 		return nil, fmt.Errorf(msg+": %w", err)
 	}
 
-	return &oldestRes[0], nil
+	return oldest, nil
 }
 
-func (s *Service) recordPublishing(logger *zap.Logger, record *sales.Record, id string, success bool) error {
-	now := time.Now().UTC()
-	publishDetails := sales.PublishDetails{
-		ID:      id,
-		Channel: sales.Twitter,
-		Time:    &now,
-		Success: success,
-	}
-
-	updates := []writer.Update{
-		{
-			Field: "twitterMediaId",
-			Value: record.TwitterMediaID,
-		},
-		{
-			Field: "publishDetails",
-			Value: &publishDetails,
-		},
-	}
-	if err := s.writer.UpdateFields(record.ID, updates...); err != nil {
-		const msg = "unable to update fields to reflect twitter media id"
-		logger.Error(msg, zap.Error(err))
-		return fmt.Errorf(msg+": %w", err)
+// recordQueueDepth records the number of sales yet to be published to the
+// channel. The depth is only reported, failing to count isn't an error.
+func (s *Service) recordQueueDepth(channel sales.PublishChannel) {
+	n, err := s.reader.CountUnpublished(channel, publishSalesSince)
+	if err != nil {
+		s.logger.Warn("unable to count unpublished sales", zap.Error(err), zap.String("channel", string(channel)))
+		return
 	}
 
-	return nil
-}
-
-type Credentials struct {
-	ConsumerKey       string
-	ConsumerSecret    string
-	AccessToken       string
-	AccessTokenSecret string
-}
-
-func authTwitter(creds Credentials) *http.Client {
-	// Credentials stores all of our access/consumer tokens
-	// and secret keys needed for authentication against
-	// the twitter REST API.
-
-	// Pass in your consumer key (API Key) and your Consumer Secret (API Secret)
-	config := oauth1.NewConfig(creds.ConsumerKey, creds.ConsumerSecret)
-	// Pass in your Access Token and your Access Token Secret
-	token := oauth1.NewToken(creds.AccessToken, creds.AccessTokenSecret)
-
-	return config.Client(oauth1.NoContext, token)
+	metrics.QueueDepth.WithLabelValues(string(channel)).Set(float64(n))
 }
 
 func isMarketplaceSale(keys []solana.PublicKey) (string, bool) {
@@ -955,12 +945,15 @@ func isMarketplaceSale(keys []solana.PublicKey) (string, bool) {
 	return "", false
 }
 
-func (s *Service) retryRPC(do func() error, retries int, timeout time.Duration) error {
+func (s *Service) retryRPC(ctx context.Context, do func() error, retries int, timeout time.Duration) error {
 	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	var retry int
 
 	for retry < retries {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-timer.C:
 			return fmt.Errorf("timeout after %s", timeout)
 		default:
@@ -976,7 +969,9 @@ func (s *Service) retryRPC(do func() error, retries int, timeout time.Duration)
 				s.logger.Debug("rate limited, sleeping...")
 				retry++
 				// solana rpc API rate limit resets every 10
-				time.Sleep(time.Second * 10)
+				if err := sleep(ctx, time.Second*10); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -984,55 +979,46 @@ func (s *Service) retryRPC(do func() error, retries int, timeout time.Duration)
 	return errors.New("error exceeded retries")
 }
 
-func getPrice(pre, post uint64) uint64 {
-	if pre < post {
-		return post - pre
-	}
-	return pre - post
-}
-
-func toSolPriceStr(price uint64) string {
-	if price < 40000000 {
-		return ""
-	}
+// sleep pauses for d, returning the context's error when it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	const lamportTensInSol = 9
-	str := strconv.FormatUint(price, 10)
-	arr := make([]string, len(str))
-	for i := len(arr) - 1; i >= 0; i-- {
-		arr[len(arr)-1-i] = string(str[i])
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
+}
 
-	if len(arr) <= lamportTensInSol {
-		priceStr := strings.Join(reverseArr(append(arr, "."+strings.Repeat("0", lamportTensInSol-len(arr)))), "")
-		if len(priceStr) > 0 && priceStr[0] == '.' {
-			return "0" + priceStr
-		}
+// getBuyerSeller returns the buyer and seller of a marketplace sale. The buyer
+// is the fee payer whose balance pays for the sale, the seller is the account
+// that received the largest share of the sale. Royalties and marketplace fees
+// go to the other accounts that had their balance increased.
+func getBuyerSeller(keys []solana.PublicKey, pre, post []uint64) (string, string) {
+	if len(keys) == 0 {
+		return "", ""
 	}
+	buyer := keys[0].String()
 
-	for i := range arr {
-		if i == lamportTensInSol-1 {
-			arr = append(append(arr[:i], "."), arr[i+1:]...)
-			break
+	var (
+		seller   string
+		received uint64
+	)
+	for i := 1; i < len(keys) && i < len(pre) && i < len(post); i++ {
+		if post[i] > pre[i] && post[i]-pre[i] > received {
+			received = post[i] - pre[i]
+			seller = keys[i].String()
 		}
 	}
 
-	return strings.Join(reverseArr(arr), "")
-}
-
-func reverseArr(arr []string) []string {
-	r := make([]string, len(arr))
-	for i := len(arr) - 1; i >= 0; i-- {
-		r[len(arr)-1-i] = arr[i]
-	}
-
-	return r
+	return buyer, seller
 }
 
-func min(i, j int) int {
-	if i < j {
-		return i
+func getPrice(pre, post uint64) uint64 {
+	if pre < post {
+		return post - pre
 	}
-
-	return j
+	return pre - post
 }
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/gateway"
+	"bromato-sales/internal/sales/media"
+	"bromato-sales/internal/sales/publisher"
+)
+
+// fakeWriter keeps the publish states in memory. The first conflicts updates
+// fail with ErrConflict, as if the record was modified concurrently.
+type fakeWriter struct {
+	mu        sync.Mutex
+	states    map[string]sales.PublishState
+	conflicts int
+}
+
+func newFakeWriter() *fakeWriter {
+	return &fakeWriter{states: make(map[string]sales.PublishState)}
+}
+
+func (w *fakeWriter) Create(*sales.Record) error { return nil }
+
+func (w *fakeWriter) MigratePublishDetails() error { return nil }
+
+func (w *fakeWriter) UpdatePublishState(
+	id string,
+	channel sales.PublishChannel,
+	update func(current *sales.PublishState) (*sales.PublishState, error)) (*sales.PublishState, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var cur *sales.PublishState
+	if state, ok := w.states[id+"/"+string(channel)]; ok {
+		cur = &state
+	}
+
+	state, err := update(cur)
+	if err != nil {
+		return nil, err
+	}
+	if w.conflicts > 0 {
+		w.conflicts--
+		return nil, sales.ErrConflict
+	}
+	w.states[id+"/"+string(channel)] = *state
+
+	return state, nil
+}
+
+func (w *fakeWriter) set(id string, channel sales.PublishChannel, state sales.PublishState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.states[id+"/"+string(channel)] = state
+}
+
+func (w *fakeWriter) state(id string, channel sales.PublishChannel) (sales.PublishState, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state, ok := w.states[id+"/"+string(channel)]
+	return state, ok
+}
+
+// fakePublisher counts the sales published to it
+type fakePublisher struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *fakePublisher) Channel() sales.PublishChannel { return sales.Twitter }
+
+func (p *fakePublisher) Publish(context.Context, sales.Record, *publisher.Media) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	return "tweet", nil
+}
+
+func newTestService(t *testing.T, w *fakeWriter) *Service {
+	t.Helper()
+
+	resolver, err := gateway.NewResolver(zap.NewNop(), gateway.Config{})
+	require.NoError(t, err)
+	processor, err := media.NewProcessor(zap.NewNop(), resolver, media.Config{})
+	require.NoError(t, err)
+	bus, err := events.NewBus(zap.NewNop())
+	require.NoError(t, err)
+
+	return &Service{
+		logger:      zap.NewNop(),
+		writer:      w,
+		retryPolicy: RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Hour},
+		lease:       Lease{Owner: "test", Duration: time.Minute},
+		resolver:    resolver,
+		media:       processor,
+		bus:         bus,
+	}
+}
+
+func TestPublishDeadLettersSaleWithFailingMedia(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing-image.json":
+			_, _ = w.Write([]byte(`{"image":"http://` + r.Host + `/image.png"}`))
+		case "/no-image.json":
+			_, _ = w.Write([]byte(`{"name":"Bromato #1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name        string
+		metadataURI string
+	}{
+		{
+			name:        "image not found",
+			metadataURI: srv.URL + "/missing-image.json",
+		},
+		{
+			name:        "metadata without image",
+			metadataURI: srv.URL + "/no-image.json",
+		},
+		{
+			name:        "metadata not found",
+			metadataURI: srv.URL + "/missing.json",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newFakeWriter()
+			s := newTestService(t, w)
+			p := &fakePublisher{}
+			rec := &sales.Record{
+				ID:         "sig",
+				MintPubkey: "mint",
+				NFT:        sales.NFT{MetadataURI: tc.metadataURI},
+			}
+
+			for attempt := 1; attempt <= s.retryPolicy.MaxAttempts; attempt++ {
+				err := s.publish(context.Background(), s.logger, p, rec, make(map[string]*nftMetadata), false)
+				require.Error(t, err)
+
+				state, ok := w.state(rec.ID, sales.Twitter)
+				require.True(t, ok)
+				require.Equal(t, attempt, state.Attempts)
+				require.NotEmpty(t, state.LastError)
+				require.Empty(t, state.LeaseOwner)
+				if attempt < s.retryPolicy.MaxAttempts {
+					require.Equal(t, sales.PublishFailed, state.Status)
+					require.NotNil(t, state.NextAttemptAt)
+				}
+			}
+
+			state, _ := w.state(rec.ID, sales.Twitter)
+			require.Equal(t, sales.PublishDead, state.Status)
+			require.NotNil(t, state.DeadLetteredAt)
+			require.Nil(t, state.NextAttemptAt)
+
+			// the dead-lettered sale is no longer attempted
+			require.NoError(t, s.publish(context.Background(), s.logger, p, rec, make(map[string]*nftMetadata), false))
+			require.Equal(t, 0, p.calls)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"go.uber.org/zap"
+
+	"bromato-sales/internal/sales"
+)
+
+const (
+	// aggregations scan every sale of the window, all-time included
+	cbTimeout = time.Second * 10
+)
+
+// Window is the time window statistics are computed over, ending now
+type Window string
+
+const (
+	Hour    Window = "1h"
+	Day     Window = "24h"
+	Week    Window = "7d"
+	Month   Window = "30d"
+	AllTime Window = "all"
+)
+
+// Windows are the supported windows, shortest first
+var Windows = []Window{Hour, Day, Week, Month, AllTime}
+
+// ParseWindow parses a window e.g. 24h
+func ParseWindow(s string) (Window, error) {
+	for _, w := range Windows {
+		if string(w) == s {
+			return w, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown window %q", s)
+}
+
+// Since returns the start of the window ending at now, nil for all-time
+func (w Window) Since(now time.Time) *time.Time {
+	var d time.Duration
+	switch w {
+	case Hour:
+		d = time.Hour
+	case Day:
+		d = 24 * time.Hour
+	case Week:
+		d = 7 * 24 * time.Hour
+	case Month:
+		d = 30 * 24 * time.Hour
+	default:
+		return nil
+	}
+
+	since := now.Add(-d).UTC()
+	return &since
+}
+
+// Summary is the aggregate of a set of sales. Prices are in lamports, the
+// average and median are rounded to the nearest lamport.
+type Summary struct {
+	Count        int    `json:"count"`
+	Volume       uint64 `json:"volume"`
+	Average      uint64 `json:"average"`
+	Median       uint64 `json:"median"`
+	Min          uint64 `json:"min"`
+	Max          uint64 `json:"max"`
+	UniqueBuyers int    `json:"uniqueBuyers"`
+}
+
+// Stats are the statistics of a collection over a window, in total and by
+// marketplace. The window is empty for statistics over a time range.
+type Stats struct {
+	Collection   sales.NFTCollection
+	Window       Window
+	Summary      Summary
+	Marketplaces map[string]Summary
+}
+
+// Filter restricts the sales statistics are computed from, zero values match
+// any sale
+type Filter struct {
+	Collection  sales.NFTCollection
+	Marketplace string
+}
+
+// Service computes sales statistics from the stored sales using N1QL
+// aggregations
+type Service struct {
+	bucket  string
+	cluster *gocb.Cluster
+	logger  *zap.Logger
+}
+
+func NewService(logger *zap.Logger, cluster *gocb.Cluster, bucket string) (*Service, error) {
+	s := Service{
+		bucket:  bucket,
+		cluster: cluster,
+		logger:  logger,
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Service) validate() error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return s.logger != nil },
+		},
+		{
+			dep: "cluster",
+			chk: func() bool { return s.cluster != nil },
+		},
+		{
+			dep: "bucket",
+			chk: func() bool { return s.bucket != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize stats service due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// Get returns the statistics of every collection over the window, ordered by
+// collection. Collections without sales in the window are omitted.
+func (s *Service) Get(window Window, filter Filter) ([]Stats, error) {
+	logger := s.logger.With(zap.String("window", string(window)))
+
+	stats, err := s.get(logger, window.Since(time.Now()), nil, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats {
+		stats[i].Window = window
+	}
+
+	return stats, nil
+}
+
+// Range returns the statistics of every collection over the sales from, and
+// including, from until to, ordered by collection
+func (s *Service) Range(from time.Time, to time.Time, filter Filter) ([]Stats, error) {
+	logger := s.logger.With(zap.Time("from", from), zap.Time("to", to))
+
+	return s.get(logger, &from, &to, filter)
+}
+
+func (s *Service) get(logger *zap.Logger, since *time.Time, until *time.Time, filter Filter) ([]Stats, error) {
+	// the median of a collection can't be derived from the medians of its
+	// marketplaces, so the totals are aggregated separately
+	totals, err := s.aggregate(since, until, filter, false)
+	if err != nil {
+		const msg = "unable to aggregate collection stats"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	byMarketplace, err := s.aggregate(since, until, filter, true)
+	if err != nil {
+		const msg = "unable to aggregate marketplace stats"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	stats := make(map[sales.NFTCollection]*Stats, len(totals))
+	for _, row := range totals {
+		stats[row.Collection] = &Stats{
+			Collection:   row.Collection,
+			Summary:      row.summary(),
+			Marketplaces: make(map[string]Summary),
+		}
+	}
+	for _, row := range byMarketplace {
+		if st, ok := stats[row.Collection]; ok {
+			st.Marketplaces[row.Marketplace] = row.summary()
+		}
+	}
+
+	result := make([]Stats, 0, len(stats))
+	for _, st := range stats {
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Collection < result[j].Collection })
+
+	return result, nil
+}
+
+// row is a row of the aggregation query, averages and medians are fractional
+type row struct {
+	Collection   sales.NFTCollection `json:"collection"`
+	Marketplace  string              `json:"marketplace"`
+	Count        int                 `json:"count"`
+	Volume       float64             `json:"volume"`
+	Average      float64             `json:"average"`
+	Median       float64             `json:"median"`
+	Min          float64             `json:"min"`
+	Max          float64             `json:"max"`
+	UniqueBuyers int                 `json:"uniqueBuyers"`
+}
+
+func (r row) summary() Summary {
+	return Summary{
+		Count:        r.Count,
+		Volume:       uint64(math.Round(r.Volume)),
+		Average:      uint64(math.Round(r.Average)),
+		Median:       uint64(math.Round(r.Median)),
+		Min:          uint64(r.Min),
+		Max:          uint64(r.Max),
+		UniqueBuyers: r.UniqueBuyers,
+	}
+}
+
+func (s *Service) aggregate(since *time.Time, until *time.Time, filter Filter, byMarketplace bool) ([]row, error) {
+	group := "x.collection"
+	if byMarketplace {
+		group += ", x.marketplace"
+	}
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "SELECT " + group + ", COUNT(1) AS count, SUM(x.price) AS volume," +
+		" AVG(x.price) AS average, MEDIAN(x.price) AS median," +
+		" MIN(x.price) AS min, MAX(x.price) AS max," +
+		" COUNT(DISTINCT x.buyer) AS uniqueBuyers" +
+		" FROM " + fqn + " x WHERE x.saleTime IS NOT MISSING"
+
+	params := make(map[string]interface{})
+	if since != nil {
+		stmt += " AND x.saleTime >= $since"
+		params["$since"] = since.UTC().Format(time.RFC3339)
+	}
+	if until != nil {
+		stmt += " AND x.saleTime < $until"
+		params["$until"] = until.UTC().Format(time.RFC3339)
+	}
+	if filter.Collection != "" {
+		stmt += " AND x.collection = $collection"
+		params["$collection"] = filter.Collection
+	}
+	if filter.Marketplace != "" {
+		stmt += " AND x.marketplace = $marketplace"
+		params["$marketplace"] = filter.Marketplace
+	}
+	stmt += " GROUP BY " + group
+
+	options := gocb.QueryOptions{
+		Timeout:         cbTimeout,
+		NamedParameters: params,
+		Readonly:        true,
+	}
+
+	s.logger.Debug("query statement", zap.String("statement", stmt), zap.Any("params", options.NamedParameters))
+	res, err := s.cluster.Query(stmt, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []row
+	for res.Next() {
+		var r row
+		if err := res.Row(&r); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal row: %w", err)
+		}
+		rows = append(rows, r)
+	}
+
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
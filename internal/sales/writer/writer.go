@@ -160,6 +160,161 @@ func (s *Service) UpdateFields(id string, updates ...Update) error {
 	return nil
 }
 
+// UpdatePublishState atomically updates the publish state of the sales record
+// for the channel. The update is given the current state, nil if there is
+// none, and returns the new state. An error returned by the update aborts it
+// and is returned as is. ErrConflict is returned when the record was modified
+// between reading and writing the state.
+func (s *Service) UpdatePublishState(
+	id string,
+	channel sales.PublishChannel,
+	update func(current *sales.PublishState) (*sales.PublishState, error)) (*sales.PublishState, error) {
+	logger := s.logger.With(zap.String("salesId", id), zap.String("channel", string(channel)))
+
+	res, err := s.collection.Get(id, &gocb.GetOptions{Timeout: cbTimeout})
+	if err != nil {
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			return nil, sales.ErrNotFound
+		}
+		const msg = "unable to get sales record"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	var rec sales.Record
+	if err := res.Content(&rec); err != nil {
+		const msg = "unable to unmarshal content into sales.Record"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	state, err := update(rec.Publishes[channel])
+	if err != nil {
+		return nil, err
+	}
+
+	// the cas fails the mutation if the record changed since it was read
+	opts := gocb.MutateInOptions{
+		Cas:     res.Cas(),
+		Timeout: cbTimeout,
+	}
+	specs := []gocb.MutateInSpec{
+		gocb.UpsertSpec("publishes."+string(channel), state, &gocb.UpsertSpecOptions{CreatePath: true}),
+	}
+	if _, err := s.collection.MutateIn(id, specs, &opts); err != nil {
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			logger.Debug("publish state modified concurrently")
+			return nil, sales.ErrConflict
+		}
+		const msg = "unable to update publish state"
+		logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	logger.Debug("successfully updated publish state", zap.String("status", string(state.Status)))
+
+	return state, nil
+}
+
+// MigratePublishDetails migrates the records that predate the per channel
+// publish state. The channel recorded in the publish details was published
+// successfully, as the details were only ever written after a successful
+// post. Records that were never published are pending on the legacy channel,
+// the only channel they were ever to be published to. It is safe to run
+// multiple times.
+func (s *Service) MigratePublishDetails() error {
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	stmt := "UPDATE " + fqn + " SET publishes = CASE WHEN publishDetails IS VALUED THEN " +
+		"OBJECT_PUT({}, publishDetails.channel, {" +
+		"\"status\": $q_published, " +
+		"\"attempts\": 1, " +
+		"\"lastError\": \"\", " +
+		"\"externalId\": publishDetails.id, " +
+		"\"firstAttemptAt\": publishDetails.time, " +
+		"\"lastAttemptAt\": publishDetails.time, " +
+		"\"publishedAt\": publishDetails.time}) " +
+		"ELSE OBJECT_PUT({}, $q_legacy, {\"status\": $q_pending, \"attempts\": 0}) END" +
+		" WHERE publishes IS MISSING"
+	namedParams := map[string]interface{}{
+		"$q_published": sales.PublishPublished,
+		"$q_pending":   sales.PublishPending,
+		"$q_legacy":    sales.Twitter,
+	}
+
+	s.logger.Debug(
+		"query statement",
+		zap.String("statement", stmt),
+		zap.Any("params", namedParams),
+	)
+	opts := gocb.QueryOptions{
+		Timeout:         time.Minute,
+		NamedParameters: namedParams,
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Metrics:         true,
+	}
+	res, err := s.cluster.Query(stmt, &opts)
+	if err != nil {
+		const msg = "unable to migrate publish details"
+		s.logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	// the result must be fully read before the metadata is available
+	for res.Next() {
+	}
+	var mutations uint64
+	if meta, err := res.MetaData(); err == nil {
+		mutations = meta.Metrics.MutationCount
+	}
+	s.logger.Debug("successfully migrated publish details", zap.Uint64("records", mutations))
+
+	return nil
+}
+
+// Append appends the values to the array field of the sales record, creating
+// the array if it does not exist yet. Only the last keep values of the array
+// are kept, so that it doesn't grow without bound.
+func (s *Service) Append(id string, field string, keep int, values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	logger := s.logger.With(zap.String("salesId", id), zap.String("field", field))
+
+	fqn := sales.FullyQualifiedCollectionName(s.bucket)
+	f := escapeField(field)
+	np := namedParamField(field)
+	appended := "ARRAY_CONCAT(IFMISSINGORNULL(" + f + ", []), " + np + ")"
+	stmt := "UPDATE " + fqn + " SET " + f + " = " + appended +
+		"[GREATEST(ARRAY_LENGTH(" + appended + ") - $q_keep, 0):]" +
+		" WHERE id = $q_id LIMIT 1"
+	namedParams := map[string]interface{}{
+		np:                      values,
+		namedParamField("id"):   id,
+		namedParamField("keep"): keep,
+	}
+
+	logger.Debug(
+		"query statement",
+		zap.String("statement", stmt),
+		zap.Any("params", namedParams),
+	)
+	opts := gocb.QueryOptions{
+		Timeout:         cbTimeout,
+		NamedParameters: namedParams,
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+	}
+	if _, err := s.cluster.Query(stmt, &opts); err != nil {
+		const msg = "unable to append to sales record"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	logger.Debug("successfully appended to sales record")
+
+	return nil
+}
+
 func (s *Service) setCollection() error {
 	bucket := s.cluster.Bucket(s.bucket)
 	if err := bucket.WaitUntilReady(cbTimeout, nil); err != nil {
@@ -0,0 +1,231 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/oauth1"
+	"go.uber.org/zap"
+)
+
+const (
+	// APIURL is the base URL of the Twitter API
+	APIURL = "https://api.twitter.com"
+
+	// UploadURL is the base URL of the Twitter media upload API
+	UploadURL = "https://upload.twitter.com"
+)
+
+// Client is a Twitter API client authenticated as a single user. Rate limits
+// communicated by Twitter are tracked per endpoint and requests to an
+// exhausted endpoint fail fast with ErrRateLimited until the limit resets.
+type Client struct {
+	apiURL    string
+	client    *http.Client
+	logger    *zap.Logger
+	uploadURL string
+
+	mu         sync.Mutex
+	rateLimits map[string]RateLimit
+}
+
+// Credentials stores all of our access/consumer tokens and secret keys needed
+// for authentication against the twitter REST API.
+type Credentials struct {
+	ConsumerKey       string
+	ConsumerSecret    string
+	AccessToken       string
+	AccessTokenSecret string
+}
+
+// Config is the configuration of the Twitter client
+type Config struct {
+	// APIURL is the base URL of the API, defaults to APIURL
+	APIURL string
+
+	// UploadURL is the base URL of the media upload API, defaults to UploadURL
+	UploadURL string
+
+	// Credentials are the credentials of the user the client acts as
+	Credentials Credentials
+
+	// HTTPClient is the client whose transport the signed requests are sent
+	// through, defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+func NewClient(logger *zap.Logger, cfg Config) (*Client, error) {
+	c := Client{
+		apiURL:     strings.TrimSuffix(cfg.APIURL, "/"),
+		logger:     logger,
+		uploadURL:  strings.TrimSuffix(cfg.UploadURL, "/"),
+		rateLimits: make(map[string]RateLimit),
+	}
+	if c.apiURL == "" {
+		c.apiURL = APIURL
+	}
+	if c.uploadURL == "" {
+		c.uploadURL = UploadURL
+	}
+
+	if err := c.validate(cfg.Credentials); err != nil {
+		return nil, err
+	}
+
+	c.client = authClient(cfg.Credentials, cfg.HTTPClient)
+
+	return &c, nil
+}
+
+func (c *Client) validate(creds Credentials) error {
+	var missingDeps []string
+
+	for _, tc := range []struct {
+		dep string
+		chk func() bool
+	}{
+		{
+			dep: "logger",
+			chk: func() bool { return c.logger != nil },
+		},
+		{
+			dep: "consumerKey",
+			chk: func() bool { return creds.ConsumerKey != "" },
+		},
+		{
+			dep: "consumerSecret",
+			chk: func() bool { return creds.ConsumerSecret != "" },
+		},
+		{
+			dep: "accessToken",
+			chk: func() bool { return creds.AccessToken != "" },
+		},
+		{
+			dep: "accessTokenSecret",
+			chk: func() bool { return creds.AccessTokenSecret != "" },
+		},
+	} {
+		if !tc.chk() {
+			missingDeps = append(missingDeps, tc.dep)
+		}
+	}
+
+	if len(missingDeps) > 0 {
+		return fmt.Errorf(
+			"unable to initialize twitter client due to (%d) missing dependencies: %s",
+			len(missingDeps),
+			strings.Join(missingDeps, ","),
+		)
+	}
+
+	return nil
+}
+
+// RateLimit returns the last rate limit communicated by Twitter for the
+// endpoint e.g. "POST /2/tweets"
+func (c *Client) RateLimit(endpoint string) (RateLimit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rl, ok := c.rateLimits[endpoint]
+	return rl, ok
+}
+
+// do sends the request and decodes a successful response into out, when
+// given. The response body is always read and closed. Non-2xx responses are
+// returned as an *APIError.
+func (c *Client) do(req *http.Request, out interface{}) error {
+	endpoint := req.Method + " " + req.URL.Path
+	logger := c.logger.With(zap.String("endpoint", endpoint))
+
+	if rl, ok := c.RateLimit(endpoint); ok && rl.Exhausted(time.Now()) {
+		logger.Warn("rate limit exhausted, skipping request", zap.Time("reset", rl.Reset))
+		return fmt.Errorf("%w: %s until %s", ErrRateLimited, endpoint, rl.Reset.UTC())
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		const msg = "unable to send request"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+	defer resp.Body.Close()
+
+	rl, hasRateLimit := parseRateLimit(resp.Header)
+	if hasRateLimit {
+		c.mu.Lock()
+		c.rateLimits[endpoint] = rl
+		c.mu.Unlock()
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		const msg = "unable to read response"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := newAPIError(endpoint, resp.StatusCode, body)
+		if hasRateLimit {
+			apiErr.RateLimit = &rl
+		}
+		logger.Error(
+			"received error from twitter",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return apiErr
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		const msg = "unable to decode response"
+		logger.Error(msg, zap.Error(err))
+		return fmt.Errorf(msg+": %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		const msg = "unable to create request"
+		c.logger.Error(msg, zap.Error(err))
+		return nil, fmt.Errorf(msg+": %w", err)
+	}
+
+	return req, nil
+}
+
+func authClient(creds Credentials, base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	// Pass in your consumer key (API Key) and your Consumer Secret (API Secret)
+	config := oauth1.NewConfig(creds.ConsumerKey, creds.ConsumerSecret)
+	// Pass in your Access Token and your Access Token Secret
+	token := oauth1.NewToken(creds.AccessToken, creds.AccessTokenSecret)
+
+	// the oauth1 client signs requests on top of the base client's transport
+	ctx := context.WithValue(oauth1.NoContext, oauth1.HTTPClient, base)
+	client := config.Client(ctx, token)
+	client.Timeout = base.Timeout
+	if client.Timeout == 0 {
+		client.Timeout = time.Minute
+	}
+
+	return client
+}
@@ -0,0 +1,185 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestClient(t *testing.T, srv *httptest.Server) *Client {
+	t.Helper()
+
+	c, err := NewClient(zap.NewNop(), Config{
+		APIURL:    srv.URL,
+		UploadURL: srv.URL,
+		Credentials: Credentials{
+			ConsumerKey:       "consumerKey",
+			ConsumerSecret:    "consumerSecret",
+			AccessToken:       "accessToken",
+			AccessTokenSecret: "accessTokenSecret",
+		},
+		HTTPClient: srv.Client(),
+	})
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestCreateTweetRateLimited(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	reset := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/2/tweets", r.URL.Path)
+		assert.Contains(t, r.Header.Get("Authorization"), "OAuth")
+
+		w.Header().Set("X-Rate-Limit-Limit", "200")
+		w.Header().Set("X-Rate-Limit-Remaining", "0")
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"title":"Too Many Requests","detail":"Too Many Requests"}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv)
+
+	_, err := c.CreateTweet(context.Background(), Tweet{Text: "sold"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrRateLimited))
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	require.Equal(t, "POST /2/tweets", apiErr.Endpoint)
+	require.NotNil(t, apiErr.RateLimit)
+	require.Equal(t, 0, apiErr.RateLimit.Remaining)
+
+	rl, ok := c.RateLimit("POST /2/tweets")
+	require.True(t, ok)
+	require.Equal(t, time.Unix(reset, 0), rl.Reset)
+
+	// the exhausted endpoint fails fast until the limit resets
+	_, err = c.CreateTweet(context.Background(), Tweet{Text: "sold"})
+	require.True(t, errors.Is(err, ErrRateLimited))
+	require.False(t, errors.As(err, &apiErr))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 1, calls)
+}
+
+func TestUploadMedia(t *testing.T) {
+	// two chunks are appended
+	data := make([]byte, maxChunkSizeInBytes+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	var (
+		mu       sync.Mutex
+		commands []string
+		appended []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1.1/media/upload.json", r.URL.Path)
+		q := r.URL.Query()
+
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, q.Get("command"))
+
+		switch q.Get("command") {
+		case "INIT":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "video/mp4", q.Get("media_type"))
+			assert.Equal(t, CategoryTweetVideo, q.Get("media_category"))
+			assert.Equal(t, strconv.Itoa(len(data)), q.Get("total_bytes"))
+			_, _ = w.Write([]byte(`{"media_id_string":"42"}`))
+		case "APPEND":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "42", q.Get("media_id"))
+			assert.Equal(t, strconv.Itoa(len(commands)-2), q.Get("segment_index"))
+
+			f, _, err := r.FormFile("media")
+			if !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			chunk, err := ioutil.ReadAll(f)
+			assert.NoError(t, err)
+			appended = append(appended, chunk...)
+			w.WriteHeader(http.StatusNoContent)
+		case "FINALIZE":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "42", q.Get("media_id"))
+			_, _ = w.Write([]byte(`{"media_id_string":"42","processing_info":{"state":"pending","check_after_secs":0}}`))
+		case "STATUS":
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, "42", q.Get("media_id"))
+			_, _ = w.Write([]byte(`{"media_id_string":"42","processing_info":{"state":"succeeded","progress_percent":100}}`))
+		default:
+			t.Errorf("unexpected command %q", q.Get("command"))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv)
+
+	id, err := c.UploadMedia(context.Background(), MediaUpload{
+		Data:      data,
+		MediaType: "video/mp4",
+		Category:  CategoryTweetVideo,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "42", id)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"INIT", "APPEND", "APPEND", "FINALIZE", "STATUS"}, commands)
+	require.Equal(t, data, appended)
+}
+
+func TestUploadMediaProcessingFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("command") {
+		case "INIT":
+			_, _ = w.Write([]byte(`{"media_id_string":"42"}`))
+		case "APPEND":
+			w.WriteHeader(http.StatusNoContent)
+		case "FINALIZE":
+			_, _ = w.Write([]byte(`{"media_id_string":"42","processing_info":{"state":"failed","error":{"code":1,"name":"InvalidMedia","message":"Invalid media"}}}`))
+		default:
+			t.Errorf("unexpected command %q", r.URL.Query().Get("command"))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv)
+
+	_, err := c.UploadMedia(context.Background(), MediaUpload{
+		Data:      []byte("gif"),
+		MediaType: "image/gif",
+		Category:  CategoryTweetGIF,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "InvalidMedia")
+}
@@ -0,0 +1,128 @@
+package twitter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is returned, wrapped, when Twitter rate limited the request
+// or the endpoint's rate limit is known to be exhausted
+var ErrRateLimited = errors.New("twitter rate limit exceeded")
+
+// APIError is a non-2xx response from Twitter
+type APIError struct {
+	// Endpoint is the method and path of the request e.g. POST /2/tweets
+	Endpoint string
+
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+
+	// Title and Detail describe v2 API errors
+	Title  string
+	Detail string
+
+	// Errors are the v1.1 API errors
+	Errors []ErrorMessage
+
+	// RateLimit is the endpoint's rate limit, if communicated
+	RateLimit *RateLimit
+}
+
+// ErrorMessage is an error returned by the v1.1 API
+type ErrorMessage struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	var details []string
+	if e.Title != "" {
+		details = append(details, e.Title)
+	}
+	if e.Detail != "" {
+		details = append(details, e.Detail)
+	}
+	for _, m := range e.Errors {
+		details = append(details, strconv.Itoa(m.Code)+" "+m.Message)
+	}
+
+	msg := fmt.Sprintf("twitter %s returned %d", e.Endpoint, e.StatusCode)
+	if len(details) > 0 {
+		msg += ": " + strings.Join(details, "; ")
+	}
+
+	return msg
+}
+
+// Unwrap allows rate limited responses to be matched with ErrRateLimited
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+func newAPIError(endpoint string, statusCode int, body []byte) *APIError {
+	apiErr := APIError{
+		Endpoint:   endpoint,
+		StatusCode: statusCode,
+	}
+
+	// the body is best effort, the status code is the error
+	var r struct {
+		Title  string         `json:"title"`
+		Detail string         `json:"detail"`
+		Errors []ErrorMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &r); err == nil {
+		apiErr.Title = r.Title
+		apiErr.Detail = r.Detail
+		apiErr.Errors = r.Errors
+	}
+
+	return &apiErr
+}
+
+// RateLimit is an endpoint's rate limit as communicated by the x-rate-limit
+// response headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Exhausted returns whether no requests remain before the limit resets
+func (r RateLimit) Exhausted(now time.Time) bool {
+	return r.Remaining <= 0 && now.Before(r.Reset)
+}
+
+// parseRateLimit parses the rate limit headers. False is returned when the
+// headers are missing or malformed.
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	var (
+		rl   RateLimit
+		err  error
+		vals = make([]int64, 3)
+	)
+	for i, h := range []string{"X-Rate-Limit-Limit", "X-Rate-Limit-Remaining", "X-Rate-Limit-Reset"} {
+		v := header.Get(h)
+		if v == "" {
+			return rl, false
+		}
+		if vals[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+			return rl, false
+		}
+	}
+
+	rl.Limit = int(vals[0])
+	rl.Remaining = int(vals[1])
+	rl.Reset = time.Unix(vals[2], 0)
+
+	return rl, true
+}
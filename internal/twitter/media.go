@@ -0,0 +1,257 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxChunkSizeInBytes = 1024 * 1024
+
+	// maxProcessingWait is how long to wait for twitter to process uploaded
+	// media before giving up
+	maxProcessingWait = 5 * time.Minute
+)
+
+// Media categories of uploaded media
+const (
+	CategoryTweetImage = "tweet_image"
+	CategoryTweetGIF   = "tweet_gif"
+	CategoryTweetVideo = "tweet_video"
+)
+
+// Processing states of uploaded media
+const (
+	ProcessingPending    = "pending"
+	ProcessingInProgress = "in_progress"
+	ProcessingSucceeded  = "succeeded"
+	ProcessingFailed     = "failed"
+)
+
+// MediaUpload is media to be uploaded
+type MediaUpload struct {
+	Data []byte
+
+	// MediaType is the MIME type of the media e.g. image/png
+	MediaType string
+
+	// Category is the media category, defaults to CategoryTweetImage
+	Category string
+}
+
+// ProcessingInfo is the processing state of uploaded media. Images are
+// usually usable immediately while GIFs and videos are processed
+// asynchronously after FINALIZE.
+type ProcessingInfo struct {
+	State           string `json:"state"`
+	CheckAfterSecs  int    `json:"check_after_secs"`
+	ProgressPercent int    `json:"progress_percent"`
+	Error           *struct {
+		Code    int    `json:"code"`
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type mediaResp struct {
+	MediaID        string          `json:"media_id_string"`
+	ProcessingInfo *ProcessingInfo `json:"processing_info"`
+}
+
+// UploadMedia uploads the media using the chunked INIT/APPEND/FINALIZE upload
+// and waits for twitter to finish processing it. The media ID is returned.
+func (c *Client) UploadMedia(ctx context.Context, upload MediaUpload) (string, error) {
+	if upload.Category == "" {
+		upload.Category = CategoryTweetImage
+	}
+	logger := c.logger.With(zap.String("mediaType", upload.MediaType), zap.String("category", upload.Category))
+
+	mediaID, err := c.uploadInit(ctx, upload)
+	if err != nil {
+		const msg = "unable to upload media INIT"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	logger = logger.With(zap.String("mediaId", mediaID))
+	logger.Debug("upload init start")
+
+	if err := c.uploadAppend(ctx, mediaID, upload.Data); err != nil {
+		const msg = "unable to upload media APPEND"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+	logger.Debug("uploaded media")
+
+	info, err := c.uploadFinalize(ctx, mediaID)
+	if err != nil {
+		const msg = "unable to upload media FINALIZE"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	if err := c.waitForProcessing(ctx, logger, mediaID, info); err != nil {
+		const msg = "unable to process media"
+		logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	return mediaID, nil
+}
+
+// MediaStatus returns the processing state of the uploaded media
+func (c *Client) MediaStatus(ctx context.Context, mediaID string) (*ProcessingInfo, error) {
+	q := make(url.Values)
+	q.Set("command", "STATUS")
+	q.Set("media_id", mediaID)
+
+	req, err := c.newRequest(ctx, http.MethodGet, c.mediaUploadURL(q), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r mediaResp
+	if err := c.do(req, &r); err != nil {
+		return nil, err
+	}
+
+	return r.ProcessingInfo, nil
+}
+
+func (c *Client) uploadInit(ctx context.Context, upload MediaUpload) (string, error) {
+	q := make(url.Values)
+	q.Set("command", "INIT")
+	q.Set("media_type", upload.MediaType)
+	q.Set("media_category", upload.Category)
+	q.Set("total_bytes", strconv.Itoa(len(upload.Data)))
+
+	req, err := c.newRequest(ctx, http.MethodPost, c.mediaUploadURL(q), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var r mediaResp
+	if err := c.do(req, &r); err != nil {
+		return "", err
+	}
+
+	return r.MediaID, nil
+}
+
+func (c *Client) uploadAppend(ctx context.Context, mediaID string, data []byte) error {
+	q := make(url.Values)
+	q.Set("command", "APPEND")
+	q.Set("media_id", mediaID)
+
+	for i := 0; len(data) > 0; i++ {
+		chunk := data[:min(len(data), maxChunkSizeInBytes)]
+		data = data[len(chunk):]
+
+		buf := new(bytes.Buffer)
+		w := multipart.NewWriter(buf)
+		part, err := w.CreateFormFile("media", "media")
+		if err != nil {
+			return fmt.Errorf("unable to create form file: %w", err)
+		}
+		if _, err := part.Write(chunk); err != nil {
+			return fmt.Errorf("unable to write chunk: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("unable to close multipart writer: %w", err)
+		}
+
+		q.Set("segment_index", strconv.Itoa(i))
+		req, err := c.newRequest(ctx, http.MethodPost, c.mediaUploadURL(q), buf)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		if err := c.do(req, nil); err != nil {
+			return fmt.Errorf("unable to append segment %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) uploadFinalize(ctx context.Context, mediaID string) (*ProcessingInfo, error) {
+	q := make(url.Values)
+	q.Set("command", "FINALIZE")
+	q.Set("media_id", mediaID)
+
+	req, err := c.newRequest(ctx, http.MethodPost, c.mediaUploadURL(q), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r mediaResp
+	if err := c.do(req, &r); err != nil {
+		return nil, err
+	}
+
+	return r.ProcessingInfo, nil
+}
+
+// waitForProcessing polls the media STATUS, as often as twitter asks us to,
+// until processing succeeds or fails. Media without processing info is ready.
+func (c *Client) waitForProcessing(ctx context.Context, logger *zap.Logger, mediaID string, info *ProcessingInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, maxProcessingWait)
+	defer cancel()
+
+	for info != nil {
+		switch info.State {
+		case ProcessingSucceeded:
+			return nil
+		case ProcessingFailed:
+			if info.Error != nil {
+				return fmt.Errorf("media processing failed: %d %s: %s", info.Error.Code, info.Error.Name, info.Error.Message)
+			}
+			return fmt.Errorf("media processing failed")
+		}
+
+		wait := time.Duration(info.CheckAfterSecs) * time.Second
+		if wait < time.Second {
+			wait = time.Second
+		}
+		logger.Debug(
+			"waiting for media processing",
+			zap.String("state", info.State),
+			zap.Int("progress", info.ProgressPercent),
+			zap.Duration("checkAfter", wait),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for media processing: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+
+		var err error
+		info, err = c.MediaStatus(ctx, mediaID)
+		if err != nil {
+			return fmt.Errorf("unable to get media status: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) mediaUploadURL(q url.Values) string {
+	return c.uploadURL + "/1.1/media/upload.json?" + q.Encode()
+}
+
+func min(i, j int) int {
+	if i < j {
+		return i
+	}
+
+	return j
+}
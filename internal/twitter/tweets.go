@@ -0,0 +1,68 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Tweet is a tweet to be created
+type Tweet struct {
+	Text string
+
+	// MediaIDs are the IDs of uploaded media to attach
+	MediaIDs []string
+}
+
+// CreateTweet tweets as the authenticated user and returns the tweet ID
+func (c *Client) CreateTweet(ctx context.Context, t Tweet) (string, error) {
+	payload := tweet{
+		Text: t.Text,
+	}
+	if len(t.MediaIDs) > 0 {
+		payload.Media = &tweetMedia{
+			MediaIds: t.MediaIDs,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		const msg = "unable to marshal tweet body"
+		c.logger.Error(msg, zap.Error(err))
+		return "", fmt.Errorf(msg+": %w", err)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, c.apiURL+"/2/tweets", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var tr tweetResp
+	if err := c.do(req, &tr); err != nil {
+		return "", fmt.Errorf("unable to post tweet: %w", err)
+	}
+
+	return tr.TweetData.ID, nil
+}
+
+type tweet struct {
+	Text  string      `json:"text"`
+	Media *tweetMedia `json:"media,omitempty"`
+}
+
+type tweetMedia struct {
+	MediaIds []string `json:"media_ids"`
+}
+
+type tweetResp struct {
+	TweetData tweetData `json:"data"`
+}
+
+type tweetData struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,33 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// User is a Twitter user
+type User struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// Me returns the authenticated user
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.apiURL+"/2/users/me", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ur userResp
+	if err := c.do(req, &ur); err != nil {
+		return nil, fmt.Errorf("unable to get authenticated user: %w", err)
+	}
+
+	return &ur.User, nil
+}
+
+type userResp struct {
+	User User `json:"data"`
+}
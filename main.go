@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,9 +17,24 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"bromato-sales/internal/api"
+	"bromato-sales/internal/health"
+	"bromato-sales/internal/leader"
+	"bromato-sales/internal/metrics"
+	"bromato-sales/internal/sales"
+	"bromato-sales/internal/sales/card"
+	"bromato-sales/internal/sales/events"
+	"bromato-sales/internal/sales/gateway"
+	"bromato-sales/internal/sales/media"
+	"bromato-sales/internal/sales/milestone"
+	"bromato-sales/internal/sales/posts"
+	"bromato-sales/internal/sales/publisher"
 	"bromato-sales/internal/sales/reader"
+	"bromato-sales/internal/sales/recap"
 	"bromato-sales/internal/sales/service"
+	"bromato-sales/internal/sales/stats"
 	"bromato-sales/internal/sales/writer"
+	"bromato-sales/internal/twitter"
 )
 
 type Config struct {
@@ -25,6 +42,106 @@ type Config struct {
 	CouchbaseUsername string `env:"COUCHBASE_USERNAME,required"`
 	CouchbasePassword string `env:"COUCHBASE_PASSWORD,required"`
 	CouchbaseBucket   string `env:"COUCHBASE_BUCKET,required"`
+
+	// PublishChannels are the channels new sales are published to
+	PublishChannels []string `env:"PUBLISH_CHANNELS" envDefault:"twitter" envSeparator:","`
+
+	// PublishMaxAttempts, PublishBaseBackoff and PublishMaxBackoff configure
+	// the retry policy of failed publishes
+	PublishMaxAttempts int           `env:"PUBLISH_MAX_ATTEMPTS" envDefault:"5"`
+	PublishBaseBackoff time.Duration `env:"PUBLISH_BASE_BACKOFF" envDefault:"30s"`
+	PublishMaxBackoff  time.Duration `env:"PUBLISH_MAX_BACKOFF" envDefault:"1h"`
+
+	// PublishLease is how long a publish job is claimed for while it is
+	// being sent, it must exceed the time it takes to publish to a channel
+	PublishLease time.Duration `env:"PUBLISH_LEASE" envDefault:"5m"`
+
+	// RecapDailySchedule and RecapWeeklySchedule are the cron specs at which
+	// the daily and weekly recaps are posted e.g. 0 14 * * *. Schedules are in
+	// UTC unless prefixed with CRON_TZ=, empty schedules disable the recaps.
+	RecapDailySchedule  string `env:"RECAP_DAILY_SCHEDULE"`
+	RecapWeeklySchedule string `env:"RECAP_WEEKLY_SCHEDULE"`
+
+	// MilestonesEnabled announces sales reaching a milestone: a new all-time
+	// high, a top MilestoneWeeklyTopN sale of the week, every
+	// MilestoneSaleCountStep sales and every MilestoneVolumeStepSOL of volume
+	// of a collection. Zero steps disable their milestone.
+	MilestonesEnabled      bool   `env:"MILESTONES_ENABLED"`
+	MilestoneWeeklyTopN    int    `env:"MILESTONE_WEEKLY_TOP_N" envDefault:"3"`
+	MilestoneSaleCountStep int    `env:"MILESTONE_SALE_COUNT_STEP" envDefault:"100"`
+	MilestoneVolumeStepSOL uint64 `env:"MILESTONE_VOLUME_STEP_SOL" envDefault:"1000"`
+
+	// APIAddr is the address the HTTP API listens on, empty disables the API
+	APIAddr string `env:"API_ADDR" envDefault:":8080"`
+
+	// LeaderElectionEnabled elects a single replica to save and publish new
+	// sales, LeaderLeaseTTL is how long it takes a standby replica to take
+	// over after the leader dies
+	LeaderElectionEnabled bool          `env:"LEADER_ELECTION_ENABLED"`
+	LeaderLeaseTTL        time.Duration `env:"LEADER_LEASE_TTL" envDefault:"30s"`
+
+	// HealthStaleAfter is how long ingestion and publishing may go without
+	// succeeding before /healthz and /readyz fail, HealthVerifyInterval is
+	// how long the credentials of the publishers are trusted once verified
+	HealthStaleAfter     time.Duration `env:"HEALTH_STALE_AFTER" envDefault:"10m"`
+	HealthVerifyInterval time.Duration `env:"HEALTH_VERIFY_INTERVAL" envDefault:"5m"`
+
+	// IPFSGateways and ArweaveGateways are the gateways, in order of
+	// preference, that ipfs:// and ar:// URIs are fetched from
+	IPFSGateways    []string      `env:"IPFS_GATEWAYS" envSeparator:"," envDefault:"https://cloudflare-ipfs.com,https://ipfs.io,https://gateway.pinata.cloud"`
+	ArweaveGateways []string      `env:"ARWEAVE_GATEWAYS" envSeparator:"," envDefault:"https://arweave.net"`
+	GatewayTimeout  time.Duration `env:"GATEWAY_TIMEOUT" envDefault:"20s"`
+
+	// MediaMaxDownloadBytes and MediaMaxAnimationBytes limit the size of
+	// downloaded NFT images and animations
+	MediaMaxDownloadBytes  int64 `env:"MEDIA_MAX_DOWNLOAD_BYTES" envDefault:"20971520"`
+	MediaMaxAnimationBytes int64 `env:"MEDIA_MAX_ANIMATION_BYTES" envDefault:"15728640"`
+
+	// MediaCacheBytes is the size of the images kept in memory
+	MediaCacheBytes int64 `env:"MEDIA_CACHE_BYTES" envDefault:"134217728"`
+
+	// SaleCardsEnabled attaches generated sale cards instead of the NFT image,
+	// SaleCardsFile configures the card of each collection, see
+	// card.ReadConfig for its format
+	SaleCardsEnabled bool   `env:"SALE_CARDS_ENABLED"`
+	SaleCardsFile    string `env:"SALE_CARDS_FILE"`
+
+	// PostTemplatesFile overrides the default post templates, see
+	// posts.ReadConfig for its format
+	PostTemplatesFile string `env:"POST_TEMPLATES_FILE"`
+
+	// RarityFile maps mint pubkeys to their rarity rank
+	RarityFile string `env:"RARITY_FILE"`
+
+	// SOLUSDPriceEnabled enables USD prices in the post templates
+	SOLUSDPriceEnabled bool `env:"SOL_USD_PRICE_ENABLED" envDefault:"true"`
+
+	TwitterAPIURL            string `env:"TWITTER_API_URL" envDefault:"https://api.twitter.com"`
+	TwitterUploadURL         string `env:"TWITTER_UPLOAD_URL" envDefault:"https://upload.twitter.com"`
+	TwitterConsumerKey       string `env:"TWITTER_CONSUMER_KEY"`
+	TwitterConsumerSecret    string `env:"TWITTER_CONSUMER_SECRET"`
+	TwitterAccessToken       string `env:"TWITTER_ACCESS_TOKEN"`
+	TwitterAccessTokenSecret string `env:"TWITTER_ACCESS_TOKEN_SECRET"`
+
+	DiscordWebhookURLs []string `env:"DISCORD_WEBHOOK_URLS" envSeparator:","`
+
+	TelegramAPIURL   string   `env:"TELEGRAM_API_URL" envDefault:"https://api.telegram.org"`
+	TelegramBotToken string   `env:"TELEGRAM_BOT_TOKEN"`
+	TelegramChatIDs  []string `env:"TELEGRAM_CHAT_IDS" envSeparator:","`
+
+	SlackWebhookURL string `env:"SLACK_WEBHOOK_URL"`
+
+	// SlackCollectionWebhooks routes collections to their own webhook, each
+	// entry is of the form collection=webhookURL
+	SlackCollectionWebhooks []string `env:"SLACK_COLLECTION_WEBHOOKS" envSeparator:","`
+
+	MastodonInstanceURL string `env:"MASTODON_INSTANCE_URL"`
+	MastodonAccessToken string `env:"MASTODON_ACCESS_TOKEN"`
+
+	// WebhookURLs and WebhookSecrets are the outbound webhook endpoints and
+	// their signing secrets, paired by position
+	WebhookURLs    []string `env:"WEBHOOK_URLS" envSeparator:","`
+	WebhookSecrets []string `env:"WEBHOOK_SECRETS" envSeparator:","`
 }
 
 func main() {
@@ -45,11 +162,86 @@ func main() {
 		log.Fatalf("unable to initialize logger: %s", err)
 	}
 
-	svc, err := getService(logger, cluster, cfg.CouchbaseBucket)
+	bus, err := events.NewBus(logger)
+	if err != nil {
+		log.Fatalf("unable to initialize event bus: %s", err)
+	}
+
+	r, err := reader.NewService(logger, cluster, cfg.CouchbaseBucket)
+	if err != nil {
+		log.Fatalf("unable to initialize reader: %s", err)
+	}
+
+	templates, err := getTemplates(logger, cfg)
+	if err != nil {
+		log.Fatalf("unable to initialize templates: %s", err)
+	}
+
+	solClient := rpc.New(rpc.MainNetBeta_RPC)
+
+	if len(os.Args) > 1 {
+		// the commands don't publish, so they don't need the credentials of
+		// the publishers
+		cmdCfg := *cfg
+		cmdCfg.PublishChannels = nil
+		svc, err := getService(logger, cluster, r, solClient, bus, templates, &cmdCfg)
+		if err != nil {
+			log.Fatalf("unable to initialize service: %s", err)
+		}
+
+		if err := runCommand(svc, r, os.Args[1:], os.Stdout); err != nil {
+			log.Fatalf("unable to run command: %s", err)
+		}
+		return
+	}
+
+	svc, err := getService(logger, cluster, r, solClient, bus, templates, cfg)
 	if err != nil {
 		log.Fatalf("unable to initialize service: %s", err)
 	}
 
+	// migrate before publishing so previously published sales aren't
+	// published again
+	if err := svc.MigratePublishState(); err != nil {
+		log.Fatalf("unable to migrate publish state: %s", err)
+	}
+
+	var elector *leader.Elector
+	if cfg.LeaderElectionEnabled {
+		elector, err = getElector(logger, cluster, cfg)
+		if err != nil {
+			log.Fatalf("unable to initialize elector: %s", err)
+		}
+	}
+
+	st, err := stats.NewService(logger, cluster, cfg.CouchbaseBucket)
+	if err != nil {
+		log.Fatalf("unable to initialize stats service: %s", err)
+	}
+
+	recapper, err := getRecapper(logger, cluster, st, r, templates, svc, cfg)
+	if err != nil {
+		log.Fatalf("unable to initialize recapper: %s", err)
+	}
+
+	announcer, err := getAnnouncer(logger, cluster, r, templates, svc, cfg)
+	if err != nil {
+		log.Fatalf("unable to initialize announcer: %s", err)
+	}
+
+	var server *api.Server
+	if cfg.APIAddr != "" {
+		checker, err := getChecker(logger, cluster, solClient, svc, elector, cfg)
+		if err != nil {
+			log.Fatalf("unable to initialize health checker: %s", err)
+		}
+
+		server, err = api.NewServer(logger, r, st, bus, checker, api.Config{Addr: cfg.APIAddr})
+		if err != nil {
+			log.Fatalf("unable to initialize api server: %s", err)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	g, gctx := errgroup.WithContext(ctx)
 
@@ -72,8 +264,22 @@ func main() {
 		}
 	})
 
+	// every replica serves the api, whether or not it leads
+	if server != nil {
+		g.Go(func() error {
+			return server.Run(gctx)
+		})
+	}
+
 	g.Go(func() error {
-		return run(gctx, logger, svc)
+		if elector == nil {
+			return run(gctx, logger, svc, bus, recapper, announcer)
+		}
+
+		// standby replicas wait for the leader to die before running
+		return elector.Run(gctx, func(ctx context.Context) error {
+			return run(ctx, logger, svc, bus, recapper, announcer)
+		})
 	})
 
 	if err := g.Wait(); err != nil {
@@ -82,36 +288,72 @@ func main() {
 
 }
 
-func run(ctx context.Context, logger *zap.Logger, svc *service.Service) error {
+func run(
+	ctx context.Context,
+	logger *zap.Logger,
+	svc *service.Service,
+	bus *events.Bus,
+	recapper *recap.Recapper,
+	announcer *milestone.Announcer) error {
 	g, _ := errgroup.WithContext(ctx)
 
 	// save new sales
 	g.Go(func() error {
 		ticker := time.NewTicker(time.Second * 30)
+		defer ticker.Stop()
 
 		for {
 			select {
+			case <-ctx.Done():
+				return nil
 			case <-ticker.C:
-				if err := svc.SaveNewSales("5ufx3eajnjPMvVbqT3hiEs7ur2ubwto4Hjr4UCTUbu7n"); err != nil {
+				if err := svc.SaveNewSales(ctx, "5ufx3eajnjPMvVbqT3hiEs7ur2ubwto4Hjr4UCTUbu7n"); err != nil && ctx.Err() == nil {
 					logger.Error("unable to save new sales", zap.Error(err))
 				}
 			}
 		}
 	})
 
-	// publish new sales
+	// publish new sales as soon as they are detected, polling picks up the
+	// retries and any sales detected before a restart
 	g.Go(func() error {
+		sub := bus.Subscribe("publisher", 64)
+		defer sub.Close()
+
 		ticker := time.NewTicker(time.Second * 15)
+		defer ticker.Stop()
+
 		for {
 			select {
+			case <-ctx.Done():
+				return nil
 			case <-ticker.C:
-				if err := svc.PublishNewSales(false); err != nil {
-					logger.Error("unable to publish new sales")
+			case e := <-sub.Events():
+				if _, ok := e.(events.SaleDetected); !ok {
+					continue
 				}
 			}
+
+			if err := svc.PublishNewSales(ctx, false); err != nil {
+				logger.Error("unable to publish new sales", zap.Error(err))
+			}
 		}
 	})
 
+	// post the scheduled recaps
+	if recapper != nil {
+		g.Go(func() error {
+			return recapper.Run(ctx)
+		})
+	}
+
+	// announce the milestones of new sales
+	if announcer != nil {
+		g.Go(func() error {
+			return announcer.Run(ctx, bus)
+		})
+	}
+
 	if err := g.Wait(); err != nil {
 		return fmt.Errorf("error waiting for go routines to finish")
 	}
@@ -128,18 +370,75 @@ func getConfig() (*Config, error) {
 	return &cfg, nil
 }
 
-func getService(logger *zap.Logger, cluster *gocb.Cluster, bucket string) (*service.Service, error) {
-	r, err := reader.NewService(logger, cluster, bucket)
+func getService(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	r *reader.Service,
+	solClient *rpc.Client,
+	bus *events.Bus,
+	templates *posts.Templates,
+	cfg *Config) (*service.Service, error) {
+	w, err := writer.NewService(logger, cluster, cfg.CouchbaseBucket)
 	if err != nil {
 		return nil, err
 	}
 
-	w, err := writer.NewService(logger, cluster, bucket)
+	publishers, err := getPublishers(logger, w, templates, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy := service.RetryPolicy{
+		MaxAttempts: cfg.PublishMaxAttempts,
+		BaseBackoff: cfg.PublishBaseBackoff,
+		MaxBackoff:  cfg.PublishMaxBackoff,
+	}
+
+	owner, err := getInstanceID()
+	if err != nil {
+		return nil, err
+	}
+	lease := service.Lease{
+		Owner:    owner,
+		Duration: cfg.PublishLease,
+	}
+
+	resolver, err := gateway.NewResolver(logger, gateway.Config{
+		IPFSGateways:    cfg.IPFSGateways,
+		ArweaveGateways: cfg.ArweaveGateways,
+		Timeout:         cfg.GatewayTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mediaProcessor, err := media.NewProcessor(logger, resolver, media.Config{
+		MaxDownloadBytes:  cfg.MediaMaxDownloadBytes,
+		MaxAnimationBytes: cfg.MediaMaxAnimationBytes,
+		CacheBytes:        cfg.MediaCacheBytes,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	svc, err := service.NewService(logger, r, w, rpc.New(rpc.MainNetBeta_RPC))
+	cards, err := getCards(logger, templates, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := service.NewService(
+		logger,
+		r,
+		w,
+		solClient,
+		retryPolicy,
+		lease,
+		resolver,
+		mediaProcessor,
+		cards,
+		bus,
+		publishers...,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -147,12 +446,283 @@ func getService(logger *zap.Logger, cluster *gocb.Cluster, bucket string) (*serv
 	return svc, nil
 }
 
+// getRecapper returns the recapper, nil when every recap is disabled
+func getRecapper(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	st *stats.Service,
+	r *reader.Service,
+	templates *posts.Templates,
+	svc *service.Service,
+	cfg *Config) (*recap.Recapper, error) {
+	if cfg.RecapDailySchedule == "" && cfg.RecapWeeklySchedule == "" {
+		return nil, nil
+	}
+
+	owner, err := getInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	return recap.NewRecapper(
+		logger,
+		cluster,
+		cfg.CouchbaseBucket,
+		st,
+		r,
+		templates,
+		svc,
+		recap.Config{
+			DailySchedule:  cfg.RecapDailySchedule,
+			WeeklySchedule: cfg.RecapWeeklySchedule,
+			Owner:          owner,
+		},
+		svc.Posters()...,
+	)
+}
+
+// getAnnouncer returns the milestone announcer, nil when milestones are
+// disabled
+func getAnnouncer(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	r *reader.Service,
+	templates *posts.Templates,
+	svc *service.Service,
+	cfg *Config) (*milestone.Announcer, error) {
+	if !cfg.MilestonesEnabled {
+		return nil, nil
+	}
+
+	owner, err := getInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	return milestone.NewAnnouncer(
+		logger,
+		cluster,
+		cfg.CouchbaseBucket,
+		r,
+		templates,
+		svc,
+		milestone.Config{
+			WeeklyTopN:    cfg.MilestoneWeeklyTopN,
+			SaleCountStep: cfg.MilestoneSaleCountStep,
+			VolumeStep:    cfg.MilestoneVolumeStepSOL * sales.LamportsPerSOL,
+			Owner:         owner,
+		},
+		svc.Posters()...,
+	)
+}
+
+func getElector(logger *zap.Logger, cluster *gocb.Cluster, cfg *Config) (*leader.Elector, error) {
+	owner, err := getInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	return leader.NewElector(logger, cluster, cfg.CouchbaseBucket, leader.Config{
+		Name:  "tracker",
+		Owner: owner,
+		TTL:   cfg.LeaderLeaseTTL,
+	})
+}
+
+// getChecker returns the health checker, the tracker of a standby replica is
+// never stale
+func getChecker(
+	logger *zap.Logger,
+	cluster *gocb.Cluster,
+	solClient *rpc.Client,
+	svc *service.Service,
+	elector *leader.Elector,
+	cfg *Config) (*health.Checker, error) {
+	hc := health.Config{
+		Bucket:         cfg.CouchbaseBucket,
+		Channels:       svc.Channels(),
+		StaleAfter:     cfg.HealthStaleAfter,
+		VerifyInterval: cfg.HealthVerifyInterval,
+	}
+	if elector != nil {
+		hc.Leadership = elector
+	}
+
+	return health.NewChecker(logger, cluster, solClient, svc.Verifiers(), hc)
+}
+
+// getInstanceID returns an identifier unique to this process
+func getInstanceID() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to get hostname: %w", err)
+	}
+
+	return hostname + "-" + strconv.Itoa(os.Getpid()), nil
+}
+
+func getPublishers(
+	logger *zap.Logger,
+	w *writer.Service,
+	templates *posts.Templates,
+	cfg *Config) ([]publisher.Publisher, error) {
+	var publishers []publisher.Publisher
+	for _, channel := range cfg.PublishChannels {
+		switch sales.PublishChannel(strings.TrimSpace(channel)) {
+		case sales.Twitter:
+			client, err := twitter.NewClient(logger, twitter.Config{
+				APIURL:    cfg.TwitterAPIURL,
+				UploadURL: cfg.TwitterUploadURL,
+				Credentials: twitter.Credentials{
+					ConsumerKey:       cfg.TwitterConsumerKey,
+					ConsumerSecret:    cfg.TwitterConsumerSecret,
+					AccessToken:       cfg.TwitterAccessToken,
+					AccessTokenSecret: cfg.TwitterAccessTokenSecret,
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize twitter client: %w", err)
+			}
+			p, err := publisher.NewTwitter(logger, templates, client)
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize twitter publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		case sales.Discord:
+			p, err := publisher.NewDiscord(logger, templates, cfg.DiscordWebhookURLs)
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize discord publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		case sales.Telegram:
+			p, err := publisher.NewTelegram(logger, templates, publisher.TelegramConfig{
+				BaseURL:  cfg.TelegramAPIURL,
+				BotToken: cfg.TelegramBotToken,
+				ChatIDs:  cfg.TelegramChatIDs,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize telegram publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		case sales.Slack:
+			webhooks := make(map[sales.NFTCollection]string, len(cfg.SlackCollectionWebhooks))
+			for _, w := range cfg.SlackCollectionWebhooks {
+				parts := strings.SplitN(w, "=", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("invalid slack collection webhook, expected collection=webhookURL: %s", w)
+				}
+				webhooks[sales.NFTCollection(parts[0])] = parts[1]
+			}
+
+			p, err := publisher.NewSlack(logger, templates, publisher.SlackConfig{
+				DefaultWebhookURL:  cfg.SlackWebhookURL,
+				CollectionWebhooks: webhooks,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize slack publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		case sales.Mastodon:
+			p, err := publisher.NewMastodon(logger, templates, publisher.MastodonConfig{
+				InstanceURL: cfg.MastodonInstanceURL,
+				AccessToken: cfg.MastodonAccessToken,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize mastodon publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		case sales.Webhook:
+			if len(cfg.WebhookURLs) != len(cfg.WebhookSecrets) {
+				return nil, fmt.Errorf(
+					"webhook urls and secrets must be paired, got (%d) urls and (%d) secrets",
+					len(cfg.WebhookURLs),
+					len(cfg.WebhookSecrets),
+				)
+			}
+			endpoints := make([]publisher.WebhookEndpoint, len(cfg.WebhookURLs))
+			for i := range cfg.WebhookURLs {
+				endpoints[i] = publisher.WebhookEndpoint{
+					URL:    cfg.WebhookURLs[i],
+					Secret: cfg.WebhookSecrets[i],
+				}
+			}
+
+			p, err := publisher.NewWebhook(logger, w, endpoints)
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize webhook publisher: %w", err)
+			}
+			publishers = append(publishers, p)
+		default:
+			return nil, fmt.Errorf("unsupported publish channel: %s", channel)
+		}
+	}
+
+	return publishers, nil
+}
+
+// getCards returns the sale card renderer, nil when sale cards are disabled
+func getCards(logger *zap.Logger, templates *posts.Templates, cfg *Config) (*card.Renderer, error) {
+	if !cfg.SaleCardsEnabled {
+		return nil, nil
+	}
+
+	var (
+		cc  card.Config
+		err error
+	)
+	if cfg.SaleCardsFile != "" {
+		cc, err = card.ReadConfig(cfg.SaleCardsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cards, err := card.NewRenderer(logger, templates, cc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize sale cards: %w", err)
+	}
+
+	return cards, nil
+}
+
+func getTemplates(logger *zap.Logger, cfg *Config) (*posts.Templates, error) {
+	var (
+		tc  posts.Config
+		err error
+	)
+	if cfg.PostTemplatesFile != "" {
+		tc, err = posts.ReadConfig(cfg.PostTemplatesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.RarityFile != "" {
+		tc.Rarity, err = posts.ReadRarity(cfg.RarityFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SOLUSDPriceEnabled {
+		tc.Prices = posts.NewCoinGecko(posts.CoinGeckoPriceURL)
+	}
+
+	templates, err := posts.NewTemplates(logger, tc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize post templates: %w", err)
+	}
+
+	return templates, nil
+}
+
 func getCluster(cfg *Config) (*gocb.Cluster, error) {
 	c, err := gocb.Connect(
 		"couchbase://"+cfg.CouchbaseEndpoint+"?ssl=no_verify",
 		gocb.ClusterOptions{
 			Username: cfg.CouchbaseUsername,
 			Password: cfg.CouchbasePassword,
+			Meter:    metrics.CouchbaseMeter{},
 		},
 	)
 	if err != nil {
@@ -47,8 +47,30 @@ echo "Creating scope and collections..."
   --bucket 'dev' \
   --create-collection 'nfts.sales'
 
+/opt/couchbase/bin/couchbase-cli collection-manage \
+  --cluster localhost:8091 \
+  --username Administrator \
+  --password password \
+  --bucket 'dev' \
+  --create-collection 'nfts.locks'
+
+/opt/couchbase/bin/couchbase-cli collection-manage \
+  --cluster localhost:8091 \
+  --username Administrator \
+  --password password \
+  --bucket 'dev' \
+  --create-collection 'nfts.recaps'
+
+/opt/couchbase/bin/couchbase-cli collection-manage \
+  --cluster localhost:8091 \
+  --username Administrator \
+  --password password \
+  --bucket 'dev' \
+  --create-collection 'nfts.milestones'
+
 echo "pausing for services to come up..."
 sleep 15
 
 /opt/couchbase/bin/cbq -u Administrator -p password -s="CREATE PRIMARY INDEX ON \`dev\`.nfts.sales;"
+/opt/couchbase/bin/cbq -u Administrator -p password -s="CREATE INDEX adv_saleTime_publishes ON \`default\`:\`dev\`.\`nfts\`.\`sales\`(\`saleTime\`,\`publishes\`);"
 /opt/couchbase/bin/cbq -u Administrator -p password -s="CREATE INDEX adv_publishDetails_saleTime ON \`default\`:\`dev\`.\`nfts\`.\`sales\`(\`publishDetails\`,\`saleTime\`);"
\ No newline at end of file